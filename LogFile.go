@@ -1,53 +1,138 @@
 package migrate
 
 import (
-	"bufio"
+	"context"
 	"errors"
 	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type LogFile struct {
 	FilePath   string
 	Migrations []Migration
+	// Maximum time Lock will wait for the lock file (DefaultLockTimeout if 0)
+	LockTimeout time.Duration
+	// Record every apply and rollback in the history file (see WithHistory)
+	history bool
+	// Lock file held by Lock
+	lockFile *os.File
+	// Encoding of the log file (see WithEncoding)
+	encoding LogEncoding
 }
 
 func (ml *LogFile) load() error {
-	logFile, err := os.OpenFile(ml.FilePath, os.O_CREATE|os.O_APPEND|os.O_RDWR, os.ModeAppend)
+	migrations, err := ml.read()
 
 	if err != nil {
-		return errors.New("Cannot open log file: " + err.Error())
+		return err
+	}
+
+	ml.Migrations = append(ml.Migrations, migrations...)
+
+	return nil
+}
+
+/*
+Returns the migrations in the log file, the file (rather than Migrations) is
+used whenever the log is modified so changes made by another process aren't lost.
+*/
+func (ml *LogFile) read() ([]Migration, error) {
+	content, err := os.ReadFile(ml.FilePath)
+
+	if err != nil {
+		return nil, fmt.Errorf("cannot read log file: %w", err)
+	}
+
+	if len(content) > 0 && content[len(content)-1] != '\n' {
+		return nil, fmt.Errorf("%s ends with a partially written line (add a line break if the line is complete)", ml.FilePath)
+	}
+
+	// The format of an existing file takes precedence over the extension
+	if ml.encoding == nil && len(content) > 0 {
+		ml.encoding = detectEncoding(content)
+	}
+
+	return ml.fileEncoding().Decode(content)
+}
+
+// Returns the encoding of the log file, chosen from the extension if not set
+func (ml *LogFile) fileEncoding() LogEncoding {
+	if ml.encoding == nil {
+		return encodingForPath(ml.FilePath)
+	}
+
+	return ml.encoding
+}
+
+// Replaces the content of the log file with the encoded migrations
+func (ml *LogFile) save(migrations []Migration) error {
+	content, err := ml.fileEncoding().Encode(migrations)
+
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(ml.FilePath, content)
+}
+
+// Parses a line written by Migration.string
+func parseLogLine(line string) (Migration, error) {
+	parts := strings.Split(line, ",")
+
+	// The checksum and metadata are optional as they weren't recorded by earlier versions
+	if len(parts) != 2 && len(parts) != 3 && len(parts) != 7 {
+		return Migration{}, errors.New("log line malformed: " + line)
+	}
+
+	Step, err := strconv.Atoi(parts[0])
+
+	if err != nil {
+		return Migration{}, errors.New("log line Step invalid: " + err.Error())
+	}
+
+	migration := Migration{
+		Name: parts[1],
+		Step: Step,
+	}
+
+	if len(parts) >= 3 {
+		migration.Checksum = parts[2]
 	}
 
-	defer logFile.Close()
+	if len(parts) == 7 {
+		migration.AppliedAt, err = parseAppliedAt(parts[3])
 
-	scanner := bufio.NewScanner(logFile)
+		if err != nil {
+			return Migration{}, errors.New("log line " + err.Error())
+		}
 
-	// Parse the file to determine the total number of Steps
-	for scanner.Scan() {
-		fileLine := scanner.Text()
-		parts := strings.Split(fileLine, ",")
+		durationMs, err := strconv.ParseInt(parts[4], 10, 64)
 
-		if len(parts) != 2 {
-			return errors.New("log line malformed: " + fileLine)
+		if err != nil {
+			return Migration{}, errors.New("log line duration invalid: " + err.Error())
 		}
 
-		Step, err := strconv.Atoi(parts[0])
+		migration.Duration = time.Duration(durationMs) * time.Millisecond
+
+		migration.Executor, err = url.PathUnescape(parts[5])
 
 		if err != nil {
-			return errors.New("log line Step invalid: " + err.Error())
+			return Migration{}, errors.New("log line executor invalid: " + err.Error())
 		}
 
-		ml.Migrations = append(ml.Migrations, Migration{
-			Name: parts[1],
-			Step: Step,
-		})
+		migration.Label, err = url.PathUnescape(parts[6])
+
+		if err != nil {
+			return Migration{}, errors.New("log line label invalid: " + err.Error())
+		}
 	}
 
-	return nil
+	return migration, nil
 }
 
 func (ml *LogFile) Contains(search string) bool {
@@ -61,47 +146,45 @@ func (ml *LogFile) Contains(search string) bool {
 }
 
 func (ml *LogFile) Add(m Migration) error {
-	file, err := os.OpenFile(ml.FilePath, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0644)
+	migrations, err := ml.read()
 
-	if err != nil {
-		return fmt.Errorf("cannot log file: %w", err)
+	// The file is created if missing
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
 	}
 
-	defer file.Close()
+	migrations = append(migrations, m)
 
-	if _, err = file.WriteString(m.string() + "\n"); err != nil {
+	if err := ml.save(migrations); err != nil {
 		return fmt.Errorf("cannot write to log file: %w", err)
 	}
 
-	ml.Migrations = append(ml.Migrations, m)
+	ml.Migrations = migrations
 
 	return nil
 }
 
 func (ml *LogFile) Pop() (Migration, error) {
-	file, err := os.OpenFile(ml.FilePath, os.O_RDWR, 0644)
+	// A missing file means the log has been removed, don't recreate it
+	migrations, err := ml.read()
+
 	if err != nil {
 		return Migration{}, err
 	}
-	defer file.Close()
 
-	// Empty the file
-	file.Truncate(0)
-	file.Seek(0, 0)
+	if len(migrations) == 0 {
+		return Migration{}, errors.New("cannot pop migration: the log is empty")
+	}
 
-	lastIndex := len(ml.Migrations) - 1
+	lastIndex := len(migrations) - 1
 
-	for i, migration := range ml.Migrations {
-		if i < lastIndex {
-			fmt.Fprintln(file, migration.string())
-		}
+	if err := ml.save(migrations[:lastIndex]); err != nil {
+		return Migration{}, fmt.Errorf("cannot write to log file: %w", err)
 	}
 
-	migration := ml.Migrations[lastIndex]
+	ml.Migrations = migrations[:lastIndex]
 
-	ml.Migrations = ml.Migrations[:lastIndex]
-
-	return migration, nil
+	return migrations[lastIndex], nil
 }
 
 func (ml *LogFile) LastStep() int {
@@ -114,6 +197,15 @@ func (ml *LogFile) LastStep() int {
 	return ml.Migrations[lastIndex].Step
 }
 
+// Returns a copy of the migrations in the log
+func (ml *LogFile) List() ([]Migration, error) {
+	migrations := make([]Migration, len(ml.Migrations))
+
+	copy(migrations, ml.Migrations)
+
+	return migrations, nil
+}
+
 // Returns an instance of MigrationLog with migrations loaded
 func (ml *LogFile) Init() error {
 	directory := filepath.Dir(ml.FilePath)
@@ -140,9 +232,19 @@ func (ml *LogFile) Init() error {
 	return nil
 }
 
-func NewLogFile(path string) (LogFile, error) {
+/*
+NewLogFile creates the log file (if it doesn't already exist) and returns the
+log with the migrations loaded. The encoding of the file is chosen with the
+WithEncoding option (see LogEncoding) and every apply and rollback can also be
+recorded in a history file with the WithHistory option.
+*/
+func NewLogFile(path string, opts ...LogOption) (LogFile, error) {
+	options := newLogOptions(opts)
+
 	log := LogFile{
 		FilePath: path,
+		history:  options.history,
+		encoding: options.encoding,
 	}
 
 	err := log.Init()
@@ -153,3 +255,404 @@ func NewLogFile(path string) (LogFile, error) {
 
 	return log, nil
 }
+
+// The context methods below check for cancellation before performing the
+// (non-cancellable) file operation.
+
+func (ml *LogFile) InitContext(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return ml.Init()
+}
+
+func (ml *LogFile) AddContext(ctx context.Context, m Migration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return ml.Add(m)
+}
+
+func (ml *LogFile) PopContext(ctx context.Context) (Migration, error) {
+	if err := ctx.Err(); err != nil {
+		return Migration{}, err
+	}
+
+	return ml.Pop()
+}
+
+func (ml *LogFile) ContainsContext(ctx context.Context, name string) bool {
+	return ml.Contains(name)
+}
+
+func (ml *LogFile) LastStepContext(ctx context.Context) int {
+	return ml.LastStep()
+}
+
+func (ml *LogFile) ListContext(ctx context.Context) ([]Migration, error) {
+	return ml.List()
+}
+
+func (ml *LogFile) lockPath() string {
+	return ml.FilePath + ".lock"
+}
+
+/*
+Lock takes an advisory lock (flock) on a lock file alongside the log file,
+waiting for any other process to release it. The lock is released by the OS if
+the process is killed while holding it. On platforms without flock the lock is
+held by creating the lock file, if a process is killed while holding the lock
+the lock file must be removed manually.
+
+Once the lock is acquired the migrations are reloaded from the log file as
+another process may have changed it since it was loaded.
+*/
+func (ml *LogFile) Lock(ctx context.Context) error {
+	err := ml.acquireLock(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	ml.Migrations = nil
+
+	if err := ml.load(); err != nil {
+		return errors.Join(err, ml.Unlock(ctx))
+	}
+
+	return nil
+}
+
+func (ml *LogFile) acquireLock(ctx context.Context) error {
+	return pollLock(ctx, ml.LockTimeout, func() (bool, error) {
+		file, acquired, err := tryLockFile(ml.lockPath())
+
+		if err != nil {
+			return false, fmt.Errorf("cannot acquire lock file: %w", err)
+		}
+
+		if !acquired {
+			return false, nil
+		}
+
+		// Record the owner to help diagnose stale locks
+		file.Truncate(0)
+		fmt.Fprintf(file, "%d,%s\n", os.Getpid(), time.Now().Format(time.RFC3339))
+
+		ml.lockFile = file
+
+		return true, nil
+	})
+}
+
+/*
+ForceUnlock removes a lock file left behind by a killed process on platforms
+without flock, elsewhere ErrForceUnlockUnsupported is returned as the lock is
+released by the OS.
+*/
+func (ml *LogFile) ForceUnlock(ctx context.Context) error {
+	err := forceUnlockFile(ml.lockPath())
+
+	if err != nil && !errors.Is(err, ErrForceUnlockUnsupported) {
+		return fmt.Errorf("cannot remove lock file: %w", err)
+	}
+
+	return err
+}
+
+// Unlock releases the lock, it does nothing if the lock isn't held
+func (ml *LogFile) Unlock(ctx context.Context) error {
+	if ml.lockFile == nil {
+		return nil
+	}
+
+	defer func() {
+		ml.lockFile = nil
+	}()
+
+	err := unlockFile(ml.lockFile)
+
+	if err != nil {
+		return fmt.Errorf("cannot release lock file: %w", err)
+	}
+
+	return nil
+}
+
+func (ml *LogFile) dirtyPath() string {
+	return ml.FilePath + ".dirty"
+}
+
+// SetDirty records the migration in flight in a file alongside the log file, the name is escaped
+func (ml *LogFile) SetDirty(ctx context.Context, d DirtyMigration) error {
+	line := fmt.Sprintf("%s,%d,%s,%s\n", d.Direction, d.Step, url.PathEscape(d.Name), d.StartedAt.Format(time.RFC3339))
+
+	err := writeFileAtomic(ml.dirtyPath(), []byte(line))
+
+	if err != nil {
+		return fmt.Errorf("cannot write dirty file: %w", err)
+	}
+
+	return nil
+}
+
+// ClearDirty removes the dirty file
+func (ml *LogFile) ClearDirty(ctx context.Context) error {
+	err := os.Remove(ml.dirtyPath())
+
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("cannot remove dirty file: %w", err)
+	}
+
+	return nil
+}
+
+// Dirty returns the migration recorded in the dirty file, false if there isn't a dirty file
+func (ml *LogFile) Dirty(ctx context.Context) (DirtyMigration, bool, error) {
+	content, err := os.ReadFile(ml.dirtyPath())
+
+	if errors.Is(err, os.ErrNotExist) {
+		return DirtyMigration{}, false, nil
+	}
+
+	if err != nil {
+		return DirtyMigration{}, false, fmt.Errorf("cannot read dirty file: %w", err)
+	}
+
+	line := strings.TrimSpace(string(content))
+	parts := strings.Split(line, ",")
+
+	if len(parts) != 4 {
+		return DirtyMigration{}, false, errors.New("dirty file malformed: " + line)
+	}
+
+	step, err := strconv.Atoi(parts[1])
+
+	if err != nil {
+		return DirtyMigration{}, false, errors.New("dirty file step invalid: " + err.Error())
+	}
+
+	startedAt, err := time.Parse(time.RFC3339, parts[3])
+
+	if err != nil {
+		return DirtyMigration{}, false, errors.New("dirty file time invalid: " + err.Error())
+	}
+
+	name, err := url.PathUnescape(parts[2])
+
+	if err != nil {
+		return DirtyMigration{}, false, errors.New("dirty file name invalid: " + err.Error())
+	}
+
+	return DirtyMigration{
+		Name:      name,
+		Direction: Direction(parts[0]),
+		Step:      step,
+		StartedAt: startedAt,
+	}, true, nil
+}
+
+func (ml *LogFile) historyPath() string {
+	return ml.FilePath + ".history"
+}
+
+/*
+AddHistory appends the event to the history file alongside the log file, it
+does nothing unless the log was created WithHistory. Each line contains the
+time, direction, step, outcome, duration (ms), name, executor, label and error
+with the free-form fields escaped.
+*/
+func (ml *LogFile) AddHistory(ctx context.Context, e HistoryEvent) error {
+	if !ml.history {
+		return nil
+	}
+
+	line := strings.Join([]string{
+		formatAppliedAt(e.Time),
+		string(e.Direction),
+		strconv.Itoa(e.Step),
+		string(e.Outcome),
+		strconv.FormatInt(e.Duration.Milliseconds(), 10),
+		url.PathEscape(e.Name),
+		url.PathEscape(e.Executor),
+		url.PathEscape(e.Label),
+		url.PathEscape(e.Error),
+	}, ",")
+
+	if err := appendLineAtomic(ml.historyPath(), line); err != nil {
+		return fmt.Errorf("cannot write to history file: %w", err)
+	}
+
+	return nil
+}
+
+// History returns the events in the history file selected by the filter
+func (ml *LogFile) History(ctx context.Context, filter HistoryFilter) ([]HistoryEvent, error) {
+	if !ml.history {
+		return nil, ErrHistoryDisabled
+	}
+
+	lines, err := readLines(ml.historyPath())
+
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("cannot read history file: %w", err)
+	}
+
+	var events []HistoryEvent
+
+	for _, line := range lines {
+		e, err := parseHistoryLine(line)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if filter.matches(e) {
+			events = append(events, e)
+		}
+	}
+
+	return events, nil
+}
+
+// Parses a line written by AddHistory
+func parseHistoryLine(line string) (HistoryEvent, error) {
+	parts := strings.Split(line, ",")
+
+	if len(parts) != 9 {
+		return HistoryEvent{}, errors.New("history line malformed: " + line)
+	}
+
+	occurredAt, err := parseAppliedAt(parts[0])
+
+	if err != nil {
+		return HistoryEvent{}, errors.New("history line " + err.Error())
+	}
+
+	step, err := strconv.Atoi(parts[2])
+
+	if err != nil {
+		return HistoryEvent{}, errors.New("history line step invalid: " + err.Error())
+	}
+
+	durationMs, err := strconv.ParseInt(parts[4], 10, 64)
+
+	if err != nil {
+		return HistoryEvent{}, errors.New("history line duration invalid: " + err.Error())
+	}
+
+	// Name, executor, label and error
+	var text [4]string
+
+	for i := range text {
+		text[i], err = url.PathUnescape(parts[5+i])
+
+		if err != nil {
+			return HistoryEvent{}, errors.New("history line malformed: " + err.Error())
+		}
+	}
+
+	return HistoryEvent{
+		Name:      text[0],
+		Step:      step,
+		Direction: Direction(parts[1]),
+		Outcome:   Outcome(parts[3]),
+		Error:     text[3],
+		Time:      occurredAt,
+		Duration:  time.Duration(durationMs) * time.Millisecond,
+		Executor:  text[1],
+		Label:     text[2],
+	}, nil
+}
+
+/*
+Returns the lines of the file, an error is returned if the last line isn't
+terminated as it was only partially written (e.g. by a process which crashed).
+*/
+func readLines(path string) ([]string, error) {
+	content, err := os.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(content) == 0 {
+		return nil, nil
+	}
+
+	if content[len(content)-1] != '\n' {
+		return nil, fmt.Errorf("%s ends with a partially written line (add a line break if the line is complete)", path)
+	}
+
+	return strings.Split(strings.TrimSuffix(string(content), "\n"), "\n"), nil
+}
+
+// Appends the line to the file (creating it if needed) with writeFileAtomic
+func appendLineAtomic(path string, line string) error {
+	content, err := os.ReadFile(path)
+
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	if len(content) > 0 && content[len(content)-1] != '\n' {
+		return fmt.Errorf("%s ends with a partially written line", path)
+	}
+
+	return writeFileAtomic(path, append(content, line+"\n"...))
+}
+
+/*
+Replaces the content of the file by writing to a temporary file in the same
+directory, syncing it to disk and renaming it over the file, a crash leaves
+either the old or the new content but never a partially written file.
+*/
+func writeFileAtomic(path string, content []byte) error {
+	dir := filepath.Dir(path)
+
+	temp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp*")
+
+	if err != nil {
+		return err
+	}
+
+	// Does nothing once the file has been renamed
+	defer os.Remove(temp.Name())
+
+	_, err = temp.Write(content)
+
+	if err == nil {
+		err = temp.Sync()
+	}
+
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return err
+	}
+
+	// CreateTemp creates the file readable by the owner only
+	mode := os.FileMode(0644)
+
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	if err := os.Chmod(temp.Name(), mode); err != nil {
+		return err
+	}
+
+	if err := os.Rename(temp.Name(), path); err != nil {
+		return err
+	}
+
+	return syncDir(dir)
+}
@@ -2,11 +2,15 @@ package migrate_test
 
 import (
 	"bufio"
+	"context"
+	"database/sql"
 	"errors"
 	"os"
 	"strconv"
 	"strings"
 	"testing"
+	"testing/fstest"
+	"time"
 
 	"github.com/jameswhoughton/migrate"
 )
@@ -48,7 +52,13 @@ func readLog() ([]migrate.Migration, error) {
 }
 
 func createLogFile(lines []string) error {
-	return os.WriteFile(LOG_DIR+string(os.PathSeparator)+LOG_FILE, []byte(strings.Join(lines, "\n")), 0644)
+	var content strings.Builder
+
+	for _, line := range lines {
+		content.WriteString(line + "\n")
+	}
+
+	return os.WriteFile(LOG_DIR+string(os.PathSeparator)+LOG_FILE, []byte(content.String()), 0644)
 }
 
 // Contains() returns true if the given migration exists in the log
@@ -114,7 +124,7 @@ func TestFileAddWillNotAddMigrationsToArrayOnError(t *testing.T) {
 		FilePath: LOG_DIR + string(os.PathSeparator) + LOG_FILE,
 	}
 
-	err := migrationLog.Add(migrate.Migration{"test", 0})
+	err := migrationLog.Add(migrate.Migration{Name: "test", Step: 0})
 
 	if err == nil {
 		t.Fatal("expecting error got nil")
@@ -145,13 +155,13 @@ func TestFileAddWillUpdateTheArrayOfMigrationsAndFile(t *testing.T) {
 		FilePath: LOG_DIR + string(os.PathSeparator) + LOG_FILE,
 	}
 
-	err = migrationLog.Add(migrate.Migration{"testA", 0})
+	err = migrationLog.Add(migrate.Migration{Name: "testA", Step: 0})
 
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	err = migrationLog.Add(migrate.Migration{"testB", 0})
+	err = migrationLog.Add(migrate.Migration{Name: "testB", Step: 0})
 
 	if err != nil {
 		t.Fatal(err)
@@ -208,7 +218,7 @@ func TestFilePopWillNotUpdateTheMigationsArrayOnError(t *testing.T) {
 		FilePath: LOG_DIR + string(os.PathSeparator) + LOG_FILE,
 	}
 
-	migrationLog.Add(migrate.Migration{"test", 0})
+	migrationLog.Add(migrate.Migration{Name: "test", Step: 0})
 
 	// Remove the file to trigger error on pop
 	os.Remove(LOG_DIR + string(os.PathSeparator) + LOG_FILE)
@@ -316,3 +326,493 @@ func TestFileLastStepReturnsNextAvaiableIndex(t *testing.T) {
 		t.Fatalf("Expected %d got %d", expected, actual)
 	}
 }
+
+// List() returns the migrations in the order they appear in the file
+func TestFileListReturnsMigrationsInOrder(t *testing.T) {
+	defer os.RemoveAll(LOG_DIR)
+
+	os.Mkdir(LOG_DIR, 0755)
+
+	err := createLogFile([]string{"1,c", "1,a", "2,b"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	migrationLog, err := migrate.NewLogFile(LOG_DIR + string(os.PathSeparator) + LOG_FILE)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	migrations, err := migrationLog.List()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []migrate.Migration{{Name: "c", Step: 1}, {Name: "a", Step: 1}, {Name: "b", Step: 2}}
+
+	if len(migrations) != len(expected) {
+		t.Fatalf("Expected %d migrations, got %d", len(expected), len(migrations))
+	}
+
+	for i, m := range expected {
+		if migrations[i] != m {
+			t.Errorf("Expected %v, got %v", m, migrations[i])
+		}
+	}
+}
+
+// The checksum is written to and loaded from the log file
+func TestFileChecksumIsPersisted(t *testing.T) {
+	defer os.RemoveAll(LOG_DIR)
+
+	os.Mkdir(LOG_DIR, 0755)
+
+	migrationLog, err := migrate.NewLogFile(LOG_DIR + string(os.PathSeparator) + LOG_FILE)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = migrationLog.Add(migrate.Migration{Name: "a", Step: 1})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = migrationLog.Add(migrate.Migration{Name: "b", Step: 2, Checksum: "abc"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := migrate.NewLogFile(LOG_DIR + string(os.PathSeparator) + LOG_FILE)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []migrate.Migration{{Name: "a", Step: 1}, {Name: "b", Step: 2, Checksum: "abc"}}
+
+	if len(reloaded.Migrations) != len(expected) {
+		t.Fatalf("Expected %d migrations, got %d", len(expected), len(reloaded.Migrations))
+	}
+
+	for i, m := range expected {
+		if reloaded.Migrations[i] != m {
+			t.Errorf("Expected %v, got %v", m, reloaded.Migrations[i])
+		}
+	}
+}
+
+// Lock() waits for the lock file to be removed
+func TestFileLockTimesOutWhenLocked(t *testing.T) {
+	defer os.RemoveAll(LOG_DIR)
+
+	migrationLog, err := migrate.NewLogFile(LOG_DIR + string(os.PathSeparator) + LOG_FILE)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	migrationLog.LockTimeout = 200 * time.Millisecond
+
+	err = migrationLog.Lock(context.Background())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = migrationLog.Lock(context.Background())
+
+	if !errors.Is(err, migrate.ErrLockTimeout) {
+		t.Fatalf("Expected ErrLockTimeout, got %v", err)
+	}
+
+	err = migrationLog.Unlock(context.Background())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = migrationLog.Lock(context.Background())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// SetDirty() records the migration in flight until ClearDirty() is called
+func TestFileDirtyRoundTrip(t *testing.T) {
+	defer os.RemoveAll(LOG_DIR)
+
+	migrationLog, err := migrate.NewLogFile(LOG_DIR + string(os.PathSeparator) + LOG_FILE)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testDirtyRoundTrip(t, &migrationLog)
+}
+
+// ForceClean() removes a dirty file which can't be read
+func TestFileForceCleanRemovesMalformedDirtyFile(t *testing.T) {
+	defer os.RemoveAll(LOG_DIR)
+
+	migrationLog, err := migrate.NewLogFile(LOG_DIR + string(os.PathSeparator) + LOG_FILE)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile(LOG_DIR+string(os.PathSeparator)+LOG_FILE+".dirty", []byte("up,1,1_a,b,2024-05-01T12:30:00Z\n"), 0644)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := migrate.Dirty(&migrationLog); err == nil {
+		t.Fatal("Expected the malformed dirty file to return an error")
+	}
+
+	_, err = migrate.ForceClean(&migrationLog)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, dirty, err := migrate.Dirty(&migrationLog)
+
+	if err != nil || dirty {
+		t.Fatalf("Expected the log to be clean, got dirty %t (%v)", dirty, err)
+	}
+}
+
+// The metadata is written to and loaded from the log file alongside lines written by earlier versions
+func TestFileMetadataIsPersisted(t *testing.T) {
+	defer os.RemoveAll(LOG_DIR)
+
+	os.Mkdir(LOG_DIR, 0755)
+
+	err := createLogFile([]string{"1,a", "1,b,abc"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	migrationLog, err := migrate.NewLogFile(LOG_DIR + string(os.PathSeparator) + LOG_FILE)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	applied := migrate.Migration{
+		Name:      "c",
+		Step:      2,
+		AppliedAt: time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC),
+		Duration:  1500 * time.Millisecond,
+		Executor:  "deploy@ci",
+		Label:     "release 1,2 (50%)",
+	}
+
+	err = migrationLog.Add(applied)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := migrate.NewLogFile(LOG_DIR + string(os.PathSeparator) + LOG_FILE)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []migrate.Migration{{Name: "a", Step: 1}, {Name: "b", Step: 1, Checksum: "abc"}, applied}
+
+	if len(reloaded.Migrations) != len(expected) {
+		t.Fatalf("Expected %d migrations, got %d", len(expected), len(reloaded.Migrations))
+	}
+
+	for i, m := range expected {
+		if reloaded.Migrations[i] != m {
+			t.Errorf("Expected %v, got %v", m, reloaded.Migrations[i])
+		}
+	}
+}
+
+// History() returns the events added with AddHistory() selected by the filter
+func TestFileHistoryRoundTrip(t *testing.T) {
+	defer os.RemoveAll(LOG_DIR)
+
+	migrationLog, err := migrate.NewLogFile(LOG_DIR+string(os.PathSeparator)+LOG_FILE, migrate.WithHistory())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testHistoryRoundTrip(t, &migrationLog)
+}
+
+// NewLogFile() rejects a log file ending with a partially written line
+func TestFileRejectsPartiallyWrittenLine(t *testing.T) {
+	defer os.RemoveAll(LOG_DIR)
+
+	os.Mkdir(LOG_DIR, 0755)
+
+	err := os.WriteFile(LOG_DIR+string(os.PathSeparator)+LOG_FILE, []byte("1,a\n2,b_cre"), 0644)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = migrate.NewLogFile(LOG_DIR + string(os.PathSeparator) + LOG_FILE)
+
+	if err == nil || !strings.Contains(err.Error(), "partially written line") {
+		t.Fatalf("Expected partially written line error, got %v", err)
+	}
+}
+
+// Add() and Pop() replace the log file without leaving temporary files behind
+func TestFileWritesAreAtomic(t *testing.T) {
+	defer os.RemoveAll(LOG_DIR)
+
+	migrationLog, err := migrate.NewLogFile(LOG_DIR + string(os.PathSeparator) + LOG_FILE)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, m := range []migrate.Migration{{Name: "a", Step: 1}, {Name: "b", Step: 1}, {Name: "c", Step: 2}} {
+		if err := migrationLog.Add(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := migrationLog.Pop(); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(LOG_DIR + string(os.PathSeparator) + LOG_FILE)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(content) != "1,a\n1,b\n" {
+		t.Errorf("Expected log file '1,a\\n1,b\\n', got %q", content)
+	}
+
+	entries, err := os.ReadDir(LOG_DIR)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, entry := range entries {
+		if strings.Contains(entry.Name(), ".tmp") {
+			t.Errorf("Temporary file %s left behind", entry.Name())
+		}
+	}
+}
+
+// Each encoding round trips the migrations (and metadata), the encoding of an existing file is detected on load
+func TestFileEncodingsRoundTrip(t *testing.T) {
+	defer os.RemoveAll(LOG_DIR)
+
+	migrations := []migrate.Migration{
+		{Name: "1_create_users", Step: 1, Checksum: "abc"},
+		{
+			Name:      "2_add, \"quoted\" name: here",
+			Step:      2,
+			AppliedAt: time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC),
+			Duration:  1500 * time.Millisecond,
+			Executor:  "ci@runner",
+			Label:     "v1.2.3",
+		},
+	}
+
+	cases := []struct {
+		file     string
+		encoding migrate.LogEncoding
+		prefix   string
+	}{
+		{"log.jsonl", nil, "{"},
+		{"log.yaml", nil, "name:"},
+		{".log", migrate.JSONLinesEncoding{}, "{"},
+		{".log", migrate.YAMLEncoding{}, "name:"},
+	}
+
+	for _, testCase := range cases {
+		os.RemoveAll(LOG_DIR)
+
+		path := LOG_DIR + string(os.PathSeparator) + testCase.file
+
+		var opts []migrate.LogOption
+
+		if testCase.encoding != nil {
+			opts = append(opts, migrate.WithEncoding(testCase.encoding))
+		}
+
+		migrationLog, err := migrate.NewLogFile(path, opts...)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, m := range migrations {
+			if err := migrationLog.Add(m); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		content, err := os.ReadFile(path)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !strings.HasPrefix(string(content), testCase.prefix) {
+			t.Errorf("%s: expected the file to start with %s, got:\n%s", testCase.file, testCase.prefix, content)
+		}
+
+		// Reloaded without the option, the encoding is detected from the content
+		reloaded, err := migrate.NewLogFile(path)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(reloaded.Migrations) != len(migrations) {
+			t.Fatalf("%s: expected %d migrations, got %d", testCase.file, len(migrations), len(reloaded.Migrations))
+		}
+
+		for i, m := range migrations {
+			if reloaded.Migrations[i] != m {
+				t.Errorf("%s: expected %v, got %v", testCase.file, m, reloaded.Migrations[i])
+			}
+		}
+
+		// Writes keep the detected encoding
+		if _, err := reloaded.Pop(); err != nil {
+			t.Fatal(err)
+		}
+
+		content, _ = os.ReadFile(path)
+
+		if !strings.HasPrefix(string(content), testCase.prefix) {
+			t.Errorf("%s: expected the file to start with %s after Pop(), got:\n%s", testCase.file, testCase.prefix, content)
+		}
+	}
+}
+
+// The CSV encoding refuses names it can't store
+func TestFileCSVEncodingRejectsComma(t *testing.T) {
+	defer os.RemoveAll(LOG_DIR)
+
+	migrationLog, err := migrate.NewLogFile(LOG_DIR + string(os.PathSeparator) + LOG_FILE)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = migrationLog.Add(migrate.Migration{Name: "1_a,b", Step: 1})
+
+	if err == nil {
+		t.Fatal("Expected an error adding a name containing a comma")
+	}
+
+	if len(migrationLog.Migrations) != 0 {
+		t.Fatalf("Expected 0 migrations, got %d", len(migrationLog.Migrations))
+	}
+}
+
+// Migrate() through a second instance of the log sees the migrations applied through the first
+func TestFileLockReloadsMigrations(t *testing.T) {
+	defer os.RemoveAll(LOG_DIR)
+	defer os.Remove("test.db")
+
+	db, _ := sql.Open("sqlite3", "test.db")
+
+	first, err := migrate.NewLogFile(LOG_DIR + string(os.PathSeparator) + LOG_FILE)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := migrate.NewLogFile(LOG_DIR + string(os.PathSeparator) + LOG_FILE)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Not idempotent, running it twice fails
+	testFs := fstest.MapFS{
+		"1_a_up.sql": {Data: []byte("CREATE TABLE a (id INT);")},
+	}
+
+	err = migrate.Migrate(db, testFs, &first)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = migrate.Migrate(db, testFs, &second)
+
+	if err != nil {
+		t.Fatalf("Expected the second Migrate() to do nothing, got %v", err)
+	}
+
+	if len(second.Migrations) != 1 {
+		t.Fatalf("Expected 1 migration in the log, got %d", len(second.Migrations))
+	}
+}
+
+func TestFileAddAndPopKeepChangesFromOtherInstances(t *testing.T) {
+	defer os.RemoveAll(LOG_DIR)
+
+	first, err := migrate.NewLogFile(LOG_DIR + string(os.PathSeparator) + LOG_FILE)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := migrate.NewLogFile(LOG_DIR + string(os.PathSeparator) + LOG_FILE)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := first.Add(migrate.Migration{Name: "1_a", Step: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := second.Add(migrate.Migration{Name: "2_b", Step: 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(second.Migrations) != 2 {
+		t.Fatalf("Expected 2 migrations after the second Add, got %d", len(second.Migrations))
+	}
+
+	popped, err := first.Pop()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if popped.Name != "2_b" {
+		t.Fatalf("Expected to pop 2_b, got %s", popped.Name)
+	}
+
+	reloaded, err := migrate.NewLogFile(LOG_DIR + string(os.PathSeparator) + LOG_FILE)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(reloaded.Migrations) != 1 || reloaded.Migrations[0].Name != "1_a" {
+		t.Fatalf("Expected only 1_a in the log file, got %+v", reloaded.Migrations)
+	}
+}
@@ -1,93 +1,91 @@
 package migrate
 
 import (
+	"context"
 	"database/sql"
-	"errors"
 	"fmt"
+	"math"
+	"strings"
+	"time"
 )
 
-type LogMySQL struct {
-	db *sql.DB
-}
-
-func (d *LogMySQL) init() error {
-	_, err := d.db.Exec("CREATE TABLE IF NOT EXISTS migrations (id INT PRIMARY KEY auto_increment, name VARCHAR(100) NOT NULL, step INT NOT NULL);")
-
-	if err != nil {
-		return fmt.Errorf("could not create migrations table: %w", err)
-	}
+// MySQLDialect is the Dialect of MySQL and MariaDB
+type MySQLDialect struct{}
 
-	return nil
+func (MySQLDialect) QuoteIdent(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
 }
 
-func (d *LogMySQL) Add(m Migration) error {
-	_, err := d.db.Exec("INSERT INTO migrations (name, step) VALUES (?, ?)", m.Name, m.Step)
-
-	if err != nil {
-		return fmt.Errorf("unable to insert migration: %w", err)
-	}
-
-	return nil
+func (MySQLDialect) Placeholder(n int) string {
+	return "?"
 }
 
-func (d *LogMySQL) Pop() (Migration, error) {
-	row := d.db.QueryRow("SELECT id, name, step FROM migrations ORDER BY id DESC LIMIT 1")
-
-	var id int
-	var name string
-	var step int
-
-	err := row.Scan(&id, &name, &step)
-
-	if err != nil {
-		return Migration{}, fmt.Errorf("unable to parse row: %w", err)
-	}
+func (MySQLDialect) CreateTable(table string, columns []string) string {
+	return "CREATE TABLE IF NOT EXISTS " + table + " (id INT PRIMARY KEY auto_increment, " + strings.Join(columns, ", ") + ");"
+}
 
-	// Remove row
-	d.db.Exec("DELETE FROM migrations WHERE id = ?", id)
+func (MySQLDialect) ColumnExists(schema, table, column string) (string, []any) {
+	return "SELECT COUNT(*) FROM information_schema.columns WHERE table_schema = COALESCE(NULLIF(?, ''), DATABASE()) AND table_name = ? AND column_name = ?", []any{schema, table, column}
+}
 
-	return Migration{
-		Name: name,
-		Step: step,
-	}, nil
+func (MySQLDialect) AddColumn(table, column string) string {
+	return "ALTER TABLE " + table + " ADD COLUMN " + column
 }
 
-func (d *LogMySQL) Contains(name string) bool {
-	row := d.db.QueryRow("SELECT id FROM migrations WHERE name = ?", name)
+/*
+Name of the lock, scoped to the database and name of the log table (given as
+arguments). They are hashed as lock names are limited to 64 characters, the name
+is always 48.
+*/
+const mysqlLockName = "CONCAT('migrate:', SHA1(CONCAT(COALESCE(NULLIF(?, ''), DATABASE(), ''), '.', ?)))"
 
-	err := row.Scan()
+/*
+Lock acquires a named lock with GET_LOCK, the lock is held by a dedicated
+connection and is automatically released by MySQL if the connection is lost.
+*/
+func (MySQLDialect) Lock(ctx context.Context, db *sql.DB, schema, table string, timeout time.Duration) (func(context.Context) error, error) {
+	acquire := func(conn *sql.Conn) error {
+		var acquired sql.NullInt64
 
-	if err != nil && errors.Is(err, sql.ErrNoRows) {
-		return false
-	}
+		err := conn.QueryRowContext(ctx, "SELECT GET_LOCK("+mysqlLockName+", ?)", schema, table, int(math.Ceil(timeout.Seconds()))).Scan(&acquired)
 
-	return true
-}
+		if err != nil {
+			return fmt.Errorf("unable to acquire lock: %w", err)
+		}
 
-func (d *LogMySQL) LastStep() int {
-	row := d.db.QueryRow("SELECT step FROM migrations ORDER BY id DESC")
+		if !acquired.Valid || acquired.Int64 != 1 {
+			return ErrLockTimeout
+		}
 
-	var step int
+		return nil
+	}
 
-	err := row.Scan(&step)
+	release := func(ctx context.Context, conn *sql.Conn) error {
+		_, err := conn.ExecContext(ctx, "DO RELEASE_LOCK("+mysqlLockName+")", schema, table)
 
-	if err != nil {
-		return 0
+		return err
 	}
 
-	return step
+	return sessionLock(ctx, db, acquire, release)
 }
 
-func NewLogMySQL(db *sql.DB) (LogMySQL, error) {
-	log := LogMySQL{
-		db: db,
-	}
+// LogMySQL is a LogSQL using the MySQLDialect
+type LogMySQL struct {
+	LogSQL
+}
 
-	err := log.init()
+/*
+NewLogMySQL creates the migrations table (if it doesn't already exist) and
+returns the log. The table can be renamed with the WithTableName option (or
+stored in another database with WithSchema) and every apply and rollback can
+also be recorded in a history table with the WithHistory option.
+*/
+func NewLogMySQL(db *sql.DB, opts ...LogOption) (LogMySQL, error) {
+	log, err := NewLogSQL(db, MySQLDialect{}, opts...)
 
 	if err != nil {
 		return LogMySQL{}, fmt.Errorf("failed to create MySQL log: %w", err)
 	}
 
-	return log, nil
+	return LogMySQL{log}, nil
 }
@@ -1,8 +1,11 @@
 package migrate_test
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"testing"
+	"time"
 
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/jameswhoughton/migrate"
@@ -17,6 +20,9 @@ func mysqlDb() (*sql.DB, func(), error) {
 
 	return db, func() {
 		db.Exec("DROP TABLE migrations")
+		db.Exec("DROP TABLE IF EXISTS migrations_lock")
+		db.Exec("DROP TABLE IF EXISTS migrations_dirty")
+		db.Exec("DROP TABLE IF EXISTS migrations_history")
 	}, nil
 
 }
@@ -65,9 +71,9 @@ func TestMySQLContainsReturnsTheCorrectResult(t *testing.T) {
 		{
 			name: "search in list",
 			migrations: []migrate.Migration{
-				{"a", 0},
-				{"b", 0},
-				{"c", 0},
+				{Name: "a", Step: 0},
+				{Name: "b", Step: 0},
+				{Name: "c", Step: 0},
 			},
 			search:   "a",
 			expected: true,
@@ -81,8 +87,8 @@ func TestMySQLContainsReturnsTheCorrectResult(t *testing.T) {
 		{
 			name: "partial search",
 			migrations: []migrate.Migration{
-				{"migration A", 0},
-				{"migration B", 0},
+				{Name: "migration A", Step: 0},
+				{Name: "migration B", Step: 0},
 			},
 			search:   "migration",
 			expected: false,
@@ -90,8 +96,8 @@ func TestMySQLContainsReturnsTheCorrectResult(t *testing.T) {
 		{
 			name: "different steps",
 			migrations: []migrate.Migration{
-				{"migration A", 0},
-				{"migration B", 1},
+				{Name: "migration A", Step: 0},
+				{Name: "migration B", Step: 1},
 			},
 			search:   "migration B",
 			expected: true,
@@ -148,8 +154,8 @@ func TestMySQLAddInsertsMigrationIntoTable(t *testing.T) {
 	expectedStep := 3
 
 	err = log.Add(migrate.Migration{
-		expectedName,
-		expectedStep,
+		Name: expectedName,
+		Step: expectedStep,
 	})
 
 	if err != nil {
@@ -175,7 +181,7 @@ func TestMySQLAddInsertsMigrationIntoTable(t *testing.T) {
 			t.Fatal(err)
 		}
 
-		migrations = append(migrations, migrate.Migration{name, step})
+		migrations = append(migrations, migrate.Migration{Name: name, Step: step})
 	}
 
 	if len(migrations) != 1 {
@@ -259,16 +265,16 @@ func TestMySQLLastStepReturnsNextAvaiableIndex(t *testing.T) {
 
 	migrations := []migrate.Migration{
 		{
-			"aaa",
-			4,
+			Name: "aaa",
+			Step: 4,
 		},
 		{
-			"bbb",
-			5,
+			Name: "bbb",
+			Step: 5,
 		},
 		{
-			"ccc",
-			5,
+			Name: "ccc",
+			Step: 5,
 		},
 	}
 
@@ -286,3 +292,198 @@ func TestMySQLLastStepReturnsNextAvaiableIndex(t *testing.T) {
 		t.Fatalf("Expected %d got %d", expected, actual)
 	}
 }
+
+func TestMySQLListReturnsMigrationsInOrder(t *testing.T) {
+	db, tearDown, err := mysqlDb()
+	defer tearDown()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log, err := migrate.NewLogMySQL(db)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []migrate.Migration{
+		{Name: "ccc", Step: 1},
+		{Name: "aaa", Step: 1},
+		{Name: "bbb", Step: 2},
+	}
+
+	for _, m := range expected {
+		_, err = db.Exec("INSERT INTO migrations (name, step) VALUES (?, ?);", m.Name, m.Step)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	migrations, err := log.List()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(migrations) != len(expected) {
+		t.Fatalf("Expected %d migrations, got %d", len(expected), len(migrations))
+	}
+
+	for i, m := range expected {
+		if migrations[i] != m {
+			t.Errorf("Expected %v, got %v", m, migrations[i])
+		}
+	}
+}
+
+// Lock() times out while another log instance holds the lock
+func TestMySQLLockTimesOutWhenLocked(t *testing.T) {
+	db, tearDown, err := mysqlDb()
+	defer tearDown()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := migrate.NewLogMySQL(db)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := migrate.NewLogMySQL(db)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second.LockTimeout = 200 * time.Millisecond
+
+	err = first.Lock(context.Background())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = second.Lock(context.Background())
+
+	if !errors.Is(err, migrate.ErrLockTimeout) {
+		t.Fatalf("Expected ErrLockTimeout, got %v", err)
+	}
+
+	err = first.Unlock(context.Background())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = second.Lock(context.Background())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second.Unlock(context.Background())
+}
+
+// SetDirty() records the migration in flight until ClearDirty() is called
+func TestMySQLDirtyRoundTrip(t *testing.T) {
+	db, tearDown, err := mysqlDb()
+	defer tearDown()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	migrationLog, err := migrate.NewLogMySQL(db)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testDirtyRoundTrip(t, &migrationLog)
+}
+
+// History() returns the events added with AddHistory() selected by the filter
+func TestMySQLHistoryRoundTrip(t *testing.T) {
+	db, tearDown, err := mysqlDb()
+	defer tearDown()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	migrationLog, err := migrate.NewLogMySQL(db, migrate.WithHistory())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testHistoryRoundTrip(t, &migrationLog)
+}
+
+// WithTableName() stores the log in the given (quoted) table
+func TestMySQLTableNameOption(t *testing.T) {
+	db, tearDown, err := mysqlDb()
+	defer tearDown()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Exec("DROP TABLE IF EXISTS `app-migrations`, `app-migrations_dirty`")
+
+	migrationLog, err := migrate.NewLogMySQL(db, migrate.WithTableName("app-migrations"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = migrationLog.Add(migrate.Migration{Name: "a", Step: 1})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var count int
+
+	db.QueryRow("SELECT COUNT(*) FROM `app-migrations`").Scan(&count)
+
+	if count != 1 {
+		t.Fatalf("Expected 1 migration in app-migrations, got %d", count)
+	}
+}
+
+// Lock() works with a table name longer than the 64 character limit of lock names
+func TestMySQLLockWithLongTableName(t *testing.T) {
+	db, tearDown, err := mysqlDb()
+	defer tearDown()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	table := "migrations_with_a_table_name_long_enough_to_exceed_the_limit"
+
+	defer db.Exec("DROP TABLE IF EXISTS " + table)
+
+	log, err := migrate.NewLogMySQL(db, migrate.WithTableName(table))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = log.Lock(context.Background())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = log.Unlock(context.Background())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+}
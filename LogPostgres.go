@@ -0,0 +1,89 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PostgresDialect is the Dialect of PostgreSQL
+type PostgresDialect struct{}
+
+func (PostgresDialect) QuoteIdent(name string) string {
+	return quoteIdent(name)
+}
+
+func (PostgresDialect) Placeholder(n int) string {
+	return "$" + strconv.Itoa(n)
+}
+
+func (PostgresDialect) CreateTable(table string, columns []string) string {
+	return "CREATE TABLE IF NOT EXISTS " + table + " (id SERIAL PRIMARY KEY, " + strings.Join(columns, ", ") + ");"
+}
+
+func (PostgresDialect) ColumnExists(schema, table, column string) (string, []any) {
+	return "SELECT COUNT(*) FROM information_schema.columns WHERE table_schema = COALESCE(NULLIF($1, ''), current_schema()) AND table_name = $2 AND column_name = $3", []any{schema, table, column}
+}
+
+func (PostgresDialect) AddColumn(table, column string) string {
+	return "ALTER TABLE " + table + " ADD COLUMN IF NOT EXISTS " + column
+}
+
+/*
+Lock acquires a session level advisory lock (keyed on the migrations table),
+the lock is held by a dedicated connection and is automatically released by
+PostgreSQL if the connection is lost.
+*/
+func (d PostgresDialect) Lock(ctx context.Context, db *sql.DB, schema, table string, timeout time.Duration) (func(context.Context) error, error) {
+	key := "migrate:" + d.QuoteIdent(table)
+
+	if schema != "" {
+		key = "migrate:" + d.QuoteIdent(schema) + "." + d.QuoteIdent(table)
+	}
+
+	acquire := func(conn *sql.Conn) error {
+		return pollLock(ctx, timeout, func() (bool, error) {
+			var acquired bool
+
+			err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock(hashtext($1))", key).Scan(&acquired)
+
+			if err != nil {
+				return false, fmt.Errorf("unable to acquire lock: %w", err)
+			}
+
+			return acquired, nil
+		})
+	}
+
+	release := func(ctx context.Context, conn *sql.Conn) error {
+		_, err := conn.ExecContext(ctx, "SELECT pg_advisory_unlock(hashtext($1))", key)
+
+		return err
+	}
+
+	return sessionLock(ctx, db, acquire, release)
+}
+
+// LogPostgres is a LogSQL using the PostgresDialect
+type LogPostgres struct {
+	LogSQL
+}
+
+/*
+NewLogPostgres creates the migrations table (if it doesn't already exist) and
+returns the log. The table can be renamed with the WithTableName option (or
+stored in a specific schema with WithSchema) and every apply and rollback can
+also be recorded in a history table with the WithHistory option.
+*/
+func NewLogPostgres(db *sql.DB, opts ...LogOption) (LogPostgres, error) {
+	log, err := NewLogSQL(db, PostgresDialect{}, opts...)
+
+	if err != nil {
+		return LogPostgres{}, fmt.Errorf("failed to create PostgreSQL log: %w", err)
+	}
+
+	return LogPostgres{log}, nil
+}
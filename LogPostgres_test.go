@@ -0,0 +1,467 @@
+package migrate_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jameswhoughton/migrate"
+	_ "github.com/lib/pq"
+)
+
+func postgresDb() (*sql.DB, func(), error) {
+	db, err := sql.Open("postgres", "postgres://postgres@127.0.0.1:8023/testing?sslmode=disable")
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return db, func() {
+		db.Exec("DROP TABLE migrations")
+		db.Exec("DROP TABLE IF EXISTS migrations_dirty")
+		db.Exec("DROP TABLE IF EXISTS migrations_history")
+		db.Exec("DROP SCHEMA IF EXISTS reporting CASCADE")
+	}, nil
+
+}
+
+func TestNewLogPostgresCreatesMigrationsTable(t *testing.T) {
+	db, tearDown, err := postgresDb()
+	defer tearDown()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = migrate.NewLogPostgres(db)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	row := db.QueryRow("SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = 'public' AND table_name = 'migrations';")
+
+	var count int
+
+	row.Scan(&count)
+
+	if count != 1 {
+		t.Errorf("Migration table missing")
+	}
+}
+
+// Contains() returns true if the given migration exists in the log
+func TestPostgresContainsReturnsTheCorrectResult(t *testing.T) {
+	db, tearDown, err := postgresDb()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type testCase struct {
+		name       string
+		migrations []migrate.Migration
+		search     string
+		expected   bool
+	}
+
+	cases := []testCase{
+		{
+			name: "search in list",
+			migrations: []migrate.Migration{
+				{Name: "a", Step: 0},
+				{Name: "b", Step: 0},
+				{Name: "c", Step: 0},
+			},
+			search:   "a",
+			expected: true,
+		},
+		{
+			name:       "empty migrations",
+			migrations: []migrate.Migration{},
+			search:     "a",
+			expected:   false,
+		},
+		{
+			name: "partial search",
+			migrations: []migrate.Migration{
+				{Name: "migration A", Step: 0},
+				{Name: "migration B", Step: 0},
+			},
+			search:   "migration",
+			expected: false,
+		},
+		{
+			name: "different steps",
+			migrations: []migrate.Migration{
+				{Name: "migration A", Step: 0},
+				{Name: "migration B", Step: 1},
+			},
+			search:   "migration B",
+			expected: true,
+		},
+	}
+
+	for _, testCase := range cases {
+		t.Run(testCase.name, func(t *testing.T) {
+			defer tearDown()
+
+			migrationLog, err := migrate.NewLogPostgres(db)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, migration := range testCase.migrations {
+				db.Exec("INSERT INTO migrations (name, step) VALUES ($1, $2);", migration.Name, migration.Step)
+			}
+
+			if migrationLog.Contains(testCase.search) != testCase.expected {
+				t.Fatalf("Expected count %t, got %t", testCase.expected, migrationLog.Contains(testCase.search))
+			}
+
+		})
+	}
+}
+
+func TestPostgresAddInsertsMigrationIntoTable(t *testing.T) {
+	db, tearDown, err := postgresDb()
+	defer tearDown()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log, err := migrate.NewLogPostgres(db)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	countQuery := db.QueryRow("SELECT COUNT(*) FROM migrations;")
+
+	var count int
+
+	countQuery.Scan(&count)
+
+	if count != 0 {
+		t.Errorf("Expected table to initially be empty, found %d rows\n", count)
+	}
+
+	expectedName := "ABC"
+	expectedStep := 3
+
+	err = log.Add(migrate.Migration{
+		Name: expectedName,
+		Step: expectedStep,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	migrationQuery, err := db.Query("SELECT name, step FROM migrations;")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer migrationQuery.Close()
+
+	var migrations []migrate.Migration
+	var name string
+	var step int
+
+	for migrationQuery.Next() {
+
+		err := migrationQuery.Scan(&name, &step)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		migrations = append(migrations, migrate.Migration{Name: name, Step: step})
+	}
+
+	if len(migrations) != 1 {
+		t.Errorf("expected 1 migration, got %d\n", len(migrations))
+	}
+
+	if migrations[0].Name != expectedName {
+		t.Errorf("expected migration name to be %s, got %s\n", expectedName, migrations[0].Name)
+	}
+
+	if migrations[0].Step != expectedStep {
+		t.Errorf("expected migration step to be %d, got %d\n", expectedStep, migrations[0].Step)
+	}
+
+}
+
+func TestPostgresPopReturnsMigrationAndRemovesFromTable(t *testing.T) {
+	db, tearDown, err := postgresDb()
+	defer tearDown()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log, err := migrate.NewLogPostgres(db)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedName := "AAA1"
+	expectedStep := 5
+
+	_, err = db.Exec("INSERT INTO migrations (name, step) VALUES ($1, $2);", expectedName, expectedStep)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	migration, err := log.Pop()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if migration.Name != expectedName {
+		t.Errorf("expected name %s, got %s\n", expectedName, migration.Name)
+	}
+
+	if migration.Step != expectedStep {
+		t.Errorf("expected step %d, got %d\n", expectedStep, migration.Step)
+	}
+
+	countQuery := db.QueryRow("SELECT COUNT(*) FROM migrations;")
+
+	var count int
+
+	countQuery.Scan(&count)
+
+	if count != 0 {
+		t.Errorf("Expected table to be empty, found %d rows\n", count)
+	}
+}
+
+// NextStep returns the next available step index
+func TestPostgresLastStepReturnsNextAvaiableIndex(t *testing.T) {
+	db, tearDown, err := postgresDb()
+	defer tearDown()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log, err := migrate.NewLogPostgres(db)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := 5
+
+	migrations := []migrate.Migration{
+		{
+			Name: "aaa",
+			Step: 4,
+		},
+		{
+			Name: "bbb",
+			Step: 5,
+		},
+		{
+			Name: "ccc",
+			Step: 5,
+		},
+	}
+
+	for _, m := range migrations {
+		_, err = db.Exec("INSERT INTO migrations (name, step) VALUES ($1, $2);", m.Name, m.Step)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	actual := log.LastStep()
+
+	if expected != actual {
+		t.Fatalf("Expected %d got %d", expected, actual)
+	}
+}
+
+func TestPostgresListReturnsMigrationsInOrder(t *testing.T) {
+	db, tearDown, err := postgresDb()
+	defer tearDown()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log, err := migrate.NewLogPostgres(db)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []migrate.Migration{
+		{Name: "ccc", Step: 1},
+		{Name: "aaa", Step: 1},
+		{Name: "bbb", Step: 2},
+	}
+
+	for _, m := range expected {
+		_, err = db.Exec("INSERT INTO migrations (name, step) VALUES ($1, $2);", m.Name, m.Step)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	migrations, err := log.List()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(migrations) != len(expected) {
+		t.Fatalf("Expected %d migrations, got %d", len(expected), len(migrations))
+	}
+
+	for i, m := range expected {
+		if migrations[i] != m {
+			t.Errorf("Expected %v, got %v", m, migrations[i])
+		}
+	}
+}
+
+// Lock() times out while another log instance holds the lock
+func TestPostgresLockTimesOutWhenLocked(t *testing.T) {
+	db, tearDown, err := postgresDb()
+	defer tearDown()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := migrate.NewLogPostgres(db)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := migrate.NewLogPostgres(db)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second.LockTimeout = 200 * time.Millisecond
+
+	err = first.Lock(context.Background())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = second.Lock(context.Background())
+
+	if !errors.Is(err, migrate.ErrLockTimeout) {
+		t.Fatalf("Expected ErrLockTimeout, got %v", err)
+	}
+
+	err = first.Unlock(context.Background())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = second.Lock(context.Background())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second.Unlock(context.Background())
+}
+
+// WithSchema() creates the migrations table in the given schema
+func TestNewLogPostgresWithSchemaCreatesTableInSchema(t *testing.T) {
+	db, tearDown, err := postgresDb()
+	defer tearDown()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = db.Exec("CREATE SCHEMA reporting")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log, err := migrate.NewLogPostgres(db, migrate.WithSchema("reporting"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	row := db.QueryRow("SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = 'reporting' AND table_name = 'migrations';")
+
+	var count int
+
+	row.Scan(&count)
+
+	if count != 1 {
+		t.Errorf("Migration table missing")
+	}
+
+	err = log.Add(migrate.Migration{Name: "aaa", Step: 1})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !log.Contains("aaa") {
+		t.Errorf("Expected migration to be in the log")
+	}
+}
+
+// SetDirty() records the migration in flight until ClearDirty() is called
+func TestPostgresDirtyRoundTrip(t *testing.T) {
+	db, tearDown, err := postgresDb()
+	defer tearDown()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	migrationLog, err := migrate.NewLogPostgres(db)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testDirtyRoundTrip(t, &migrationLog)
+}
+
+// History() returns the events added with AddHistory() selected by the filter
+func TestPostgresHistoryRoundTrip(t *testing.T) {
+	db, tearDown, err := postgresDb()
+	defer tearDown()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	migrationLog, err := migrate.NewLogPostgres(db, migrate.WithHistory())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testHistoryRoundTrip(t, &migrationLog)
+}
@@ -0,0 +1,474 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+/*
+Dialect describes the SQL accepted by a DBMS, it is used by LogSQL to store the
+log in any database with a database/sql driver. The package includes dialects
+for SQLite, MySQL/MariaDB, PostgreSQL and SQL Server.
+
+Table names passed to the dialect are quoted (and schema qualified) with
+QuoteIdent unless stated otherwise.
+*/
+type Dialect interface {
+	// Quotes a table or schema name, escaping any embedded quotes
+	QuoteIdent(name string) string
+
+	// Returns the placeholder of the nth (from 1) argument of a query, e.g. `?` or `$1`
+	Placeholder(n int) string
+
+	/*
+		Returns the statement creating the table (if it doesn't already exist) with
+		an auto incrementing integer `id` primary key followed by the columns. The
+		column definitions use the types INTEGER, BIGINT, VARCHAR(n) and TEXT.
+	*/
+	CreateTable(table string, columns []string) string
+
+	/*
+		Returns the query (and its arguments) counting the columns of the table
+		with the given name, schema and table are unquoted and schema is empty for
+		the default schema of the connection.
+	*/
+	ColumnExists(schema, table, column string) (string, []any)
+
+	// Returns the statement adding the column (e.g. `label VARCHAR(255)`) to the table
+	AddColumn(table, column string) string
+
+	/*
+		Acquires the migration lock of the log table (schema and table are
+		unquoted), waiting up to timeout for another process to release it, and
+		returns a function which releases the lock. ErrLockTimeout should be
+		returned if the lock can't be acquired in time.
+	*/
+	Lock(ctx context.Context, db *sql.DB, schema, table string, timeout time.Duration) (func(context.Context) error, error)
+}
+
+/*
+Optional extension of Dialect for locks which aren't released if the process
+holding them is killed (e.g. the lock table of SQLiteDialect), ForceUnlock
+releases the lock of the log table (schema and table are unquoted) whoever holds it.
+*/
+type DialectForceUnlocker interface {
+	ForceUnlock(ctx context.Context, db *sql.DB, schema, table string) error
+}
+
+/*
+LogSQL stores the log in a database using the SQL of the given Dialect, see
+NewLogSQL. LogSQLite, LogMySQL and LogPostgres are LogSQL with the dialect of
+the DBMS.
+*/
+type LogSQL struct {
+	db      *sql.DB
+	dialect Dialect
+	tables  logTables
+	// Record every apply and rollback in the history table (see WithHistory)
+	history bool
+	// Maximum time Lock will wait for the lock (DefaultLockTimeout if 0)
+	LockTimeout time.Duration
+	// Releases the lock held by Lock
+	unlock func(context.Context) error
+}
+
+func (d *LogSQL) Init() error {
+	return d.InitContext(context.Background())
+}
+
+func (d *LogSQL) InitContext(ctx context.Context) error {
+	_, err := d.db.ExecContext(ctx, d.dialect.CreateTable(d.tables.log, []string{
+		"name VARCHAR(100) NOT NULL",
+		"step INTEGER NOT NULL",
+		"checksum VARCHAR(64) NOT NULL DEFAULT ''",
+		"applied_at VARCHAR(35) NOT NULL DEFAULT ''",
+		"duration_ms BIGINT NOT NULL DEFAULT 0",
+		"executor VARCHAR(255) NOT NULL DEFAULT ''",
+		"label VARCHAR(255) NOT NULL DEFAULT ''",
+	}))
+
+	if err != nil {
+		return fmt.Errorf("could not create migrations table: %w", err)
+	}
+
+	// Tables created by earlier versions are missing the newer columns
+	for _, column := range logUpgradeColumns {
+		var count int
+
+		query, args := d.dialect.ColumnExists(d.tables.schema, d.tables.name, column.name)
+
+		err = d.db.QueryRowContext(ctx, query, args...).Scan(&count)
+
+		if err != nil {
+			return fmt.Errorf("could not inspect migrations table: %w", err)
+		}
+
+		if count == 0 {
+			_, err = d.db.ExecContext(ctx, d.dialect.AddColumn(d.tables.log, column.name+" "+column.definition))
+
+			if err != nil {
+				return fmt.Errorf("could not add %s column to migrations table: %w", column.name, err)
+			}
+		}
+	}
+
+	// The dirty table holds at most one row so it has no id, only the migrations table is upgraded (see logUpgradeColumns)
+	_, err = d.db.ExecContext(ctx, d.dialect.CreateTable(d.tables.dirty, []string{
+		"name VARCHAR(255) NOT NULL",
+		"direction VARCHAR(4) NOT NULL",
+		"step INTEGER NOT NULL",
+		"started_at VARCHAR(35) NOT NULL",
+	}))
+
+	if err != nil {
+		return fmt.Errorf("could not create dirty table: %w", err)
+	}
+
+	if d.history {
+		_, err = d.db.ExecContext(ctx, d.dialect.CreateTable(d.tables.history, []string{
+			"name VARCHAR(255) NOT NULL",
+			"step INTEGER NOT NULL",
+			"direction VARCHAR(4) NOT NULL",
+			"outcome VARCHAR(10) NOT NULL",
+			"error_message TEXT NOT NULL",
+			"occurred_at VARCHAR(35) NOT NULL",
+			"duration_ms BIGINT NOT NULL",
+			"executor VARCHAR(255) NOT NULL",
+			"label VARCHAR(255) NOT NULL",
+		}))
+
+		if err != nil {
+			return fmt.Errorf("could not create history table: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Returns the comma separated placeholders of n arguments
+func (d *LogSQL) placeholders(n int) string {
+	placeholders := make([]string, n)
+
+	for i := range placeholders {
+		placeholders[i] = d.dialect.Placeholder(i + 1)
+	}
+
+	return strings.Join(placeholders, ", ")
+}
+
+func (d *LogSQL) Add(m Migration) error {
+	return d.AddContext(context.Background(), m)
+}
+
+func (d *LogSQL) AddContext(ctx context.Context, m Migration) error {
+	return d.add(ctx, d.db, m)
+}
+
+// Adds the migration to the log within the given transaction
+func (d *LogSQL) AddTx(ctx context.Context, tx *sql.Tx, m Migration) error {
+	return d.add(ctx, tx, m)
+}
+
+func (d *LogSQL) add(ctx context.Context, q queryer, m Migration) error {
+	values := migrationValues(m)
+
+	_, err := q.ExecContext(ctx, "INSERT INTO "+d.tables.log+" ("+migrationColumns+") VALUES ("+d.placeholders(len(values))+")", values...)
+
+	if err != nil {
+		return fmt.Errorf("unable to insert migration: %w", err)
+	}
+
+	return nil
+}
+
+func (d *LogSQL) Pop() (Migration, error) {
+	return d.PopContext(context.Background())
+}
+
+func (d *LogSQL) PopContext(ctx context.Context) (Migration, error) {
+	return d.pop(ctx, d.db)
+}
+
+// Removes the most recent migration from the log within the given transaction
+func (d *LogSQL) PopTx(ctx context.Context, tx *sql.Tx) (Migration, error) {
+	return d.pop(ctx, tx)
+}
+
+func (d *LogSQL) pop(ctx context.Context, q queryer) (Migration, error) {
+	row := q.QueryRowContext(ctx, "SELECT id, "+migrationColumns+" FROM "+d.tables.log+" WHERE id = (SELECT MAX(id) FROM "+d.tables.log+")")
+
+	var id int
+
+	m, err := scanMigration(row, &id)
+
+	if err != nil {
+		return Migration{}, fmt.Errorf("unable to parse row: %w", err)
+	}
+
+	// Remove row
+	_, err = q.ExecContext(ctx, "DELETE FROM "+d.tables.log+" WHERE id = "+d.dialect.Placeholder(1), id)
+
+	if err != nil {
+		return Migration{}, fmt.Errorf("unable to remove migration: %w", err)
+	}
+
+	return m, nil
+}
+
+// Returns true if the log is stored in the given database
+func (d *LogSQL) UsesDB(db *sql.DB) bool {
+	return d.db == db
+}
+
+// Starts a transaction on the database storing the log
+func (d *LogSQL) beginTx(ctx context.Context) (*sql.Tx, error) {
+	return d.db.BeginTx(ctx, nil)
+}
+
+func (d *LogSQL) Contains(name string) bool {
+	return d.ContainsContext(context.Background(), name)
+}
+
+func (d *LogSQL) ContainsContext(ctx context.Context, name string) bool {
+	row := d.db.QueryRowContext(ctx, "SELECT id FROM "+d.tables.log+" WHERE name = "+d.dialect.Placeholder(1), name)
+
+	var id int
+
+	err := row.Scan(&id)
+
+	if err != nil && errors.Is(err, sql.ErrNoRows) {
+		return false
+	}
+
+	return true
+}
+
+func (d *LogSQL) LastStep() int {
+	return d.LastStepContext(context.Background())
+}
+
+func (d *LogSQL) LastStepContext(ctx context.Context) int {
+	row := d.db.QueryRowContext(ctx, "SELECT step FROM "+d.tables.log+" WHERE id = (SELECT MAX(id) FROM "+d.tables.log+")")
+
+	var step int
+
+	err := row.Scan(&step)
+
+	if err != nil {
+		return 0
+	}
+
+	return step
+}
+
+func (d *LogSQL) List() ([]Migration, error) {
+	return d.ListContext(context.Background())
+}
+
+func (d *LogSQL) ListContext(ctx context.Context) ([]Migration, error) {
+	rows, err := d.db.QueryContext(ctx, "SELECT "+migrationColumns+" FROM "+d.tables.log+" ORDER BY id")
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to query migrations: %w", err)
+	}
+
+	defer rows.Close()
+
+	var migrations []Migration
+
+	for rows.Next() {
+		m, err := scanMigration(rows)
+
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse row: %w", err)
+		}
+
+		migrations = append(migrations, m)
+	}
+
+	return migrations, rows.Err()
+}
+
+// Lock acquires the migration lock using the lock of the dialect (see Dialect.Lock)
+func (d *LogSQL) Lock(ctx context.Context) error {
+	unlock, err := d.dialect.Lock(ctx, d.db, d.tables.schema, d.tables.name, lockTimeout(d.LockTimeout))
+
+	if err != nil {
+		return err
+	}
+
+	d.unlock = unlock
+
+	return nil
+}
+
+/*
+ForceUnlock releases a lock left behind by a killed process if the dialect
+implements DialectForceUnlocker, otherwise ErrForceUnlockUnsupported is returned
+as the lock is released with the connection holding it.
+*/
+func (d *LogSQL) ForceUnlock(ctx context.Context) error {
+	dialect, ok := d.dialect.(DialectForceUnlocker)
+
+	if !ok {
+		return ErrForceUnlockUnsupported
+	}
+
+	return dialect.ForceUnlock(ctx, d.db, d.tables.schema, d.tables.name)
+}
+
+// Unlock releases the migration lock, it does nothing if the lock isn't held
+func (d *LogSQL) Unlock(ctx context.Context) error {
+	if d.unlock == nil {
+		return nil
+	}
+
+	defer func() {
+		d.unlock = nil
+	}()
+
+	return d.unlock(ctx)
+}
+
+/*
+NewLogSQL creates the migrations table (if it doesn't already exist) using the
+SQL of the dialect and returns the log. The table can be renamed with the
+WithTableName option (or qualified with WithSchema) and every apply and
+rollback can also be recorded in a history table with the WithHistory option.
+*/
+func NewLogSQL(db *sql.DB, dialect Dialect, opts ...LogOption) (LogSQL, error) {
+	options := newLogOptions(opts)
+
+	log := LogSQL{
+		db:      db,
+		dialect: dialect,
+		tables:  newLogTables(options, dialect.QuoteIdent),
+		history: options.history,
+	}
+
+	err := log.Init()
+
+	if err != nil {
+		return LogSQL{}, err
+	}
+
+	return log, nil
+}
+
+// SetDirty records the migration in flight in the dirty table
+func (d *LogSQL) SetDirty(ctx context.Context, m DirtyMigration) error {
+	_, err := d.db.ExecContext(ctx, "DELETE FROM "+d.tables.dirty)
+
+	if err != nil {
+		return fmt.Errorf("unable to clear dirty migration: %w", err)
+	}
+
+	_, err = d.db.ExecContext(ctx, "INSERT INTO "+d.tables.dirty+" (name, direction, step, started_at) VALUES ("+d.placeholders(4)+")", m.Name, string(m.Direction), m.Step, m.StartedAt.Format(time.RFC3339))
+
+	if err != nil {
+		return fmt.Errorf("unable to insert dirty migration: %w", err)
+	}
+
+	return nil
+}
+
+// ClearDirty removes the migration in flight
+func (d *LogSQL) ClearDirty(ctx context.Context) error {
+	_, err := d.db.ExecContext(ctx, "DELETE FROM "+d.tables.dirty)
+
+	if err != nil {
+		return fmt.Errorf("unable to clear dirty migration: %w", err)
+	}
+
+	return nil
+}
+
+// Dirty returns the migration in flight, false if there isn't one
+func (d *LogSQL) Dirty(ctx context.Context) (DirtyMigration, bool, error) {
+	return scanDirty(d.db.QueryRowContext(ctx, "SELECT name, direction, step, started_at FROM "+d.tables.dirty))
+}
+
+// AddHistory appends the event to the history table, it does nothing unless the log was created WithHistory
+func (d *LogSQL) AddHistory(ctx context.Context, e HistoryEvent) error {
+	if !d.history {
+		return nil
+	}
+
+	values := historyValues(e)
+
+	_, err := d.db.ExecContext(ctx, "INSERT INTO "+d.tables.history+" ("+historyColumns+") VALUES ("+d.placeholders(len(values))+")", values...)
+
+	if err != nil {
+		return fmt.Errorf("unable to insert history event: %w", err)
+	}
+
+	return nil
+}
+
+// History returns the events in the history table selected by the filter
+func (d *LogSQL) History(ctx context.Context, filter HistoryFilter) ([]HistoryEvent, error) {
+	if !d.history {
+		return nil, ErrHistoryDisabled
+	}
+
+	query, args := historyQuery(d.tables.history, filter, d.dialect.Placeholder)
+
+	rows, err := d.db.QueryContext(ctx, query, args...)
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to query history: %w", err)
+	}
+
+	defer rows.Close()
+
+	var events []HistoryEvent
+
+	for rows.Next() {
+		e, err := scanHistoryEvent(rows)
+
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse row: %w", err)
+		}
+
+		events = append(events, e)
+	}
+
+	return events, rows.Err()
+}
+
+/*
+Acquires a session level lock on a dedicated connection, the lock is released
+(and the connection closed) by the returned function. Session level locks are
+released by the database if the connection is lost.
+*/
+func sessionLock(ctx context.Context, db *sql.DB, acquire func(conn *sql.Conn) error, release func(ctx context.Context, conn *sql.Conn) error) (func(context.Context) error, error) {
+	conn, err := db.Conn(ctx)
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to open connection: %w", err)
+	}
+
+	err = acquire(conn)
+
+	if err != nil {
+		conn.Close()
+
+		return nil, err
+	}
+
+	return func(ctx context.Context) error {
+		defer conn.Close()
+
+		err := release(ctx, conn)
+
+		if err != nil {
+			return fmt.Errorf("unable to release lock: %w", err)
+		}
+
+		return nil
+	}, nil
+}
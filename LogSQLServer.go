@@ -0,0 +1,90 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+SQLServerDialect is the Dialect of Microsoft SQL Server, the package doesn't
+import a SQL Server driver so the log is created with NewLogSQL using a
+database opened with the driver of your choice (e.g. go-mssqldb).
+*/
+type SQLServerDialect struct{}
+
+func (SQLServerDialect) QuoteIdent(name string) string {
+	return "[" + strings.ReplaceAll(name, "]", "]]") + "]"
+}
+
+func (SQLServerDialect) Placeholder(n int) string {
+	return "@p" + strconv.Itoa(n)
+}
+
+// TEXT is deprecated by SQL Server so is replaced with NVARCHAR(MAX)
+func (SQLServerDialect) CreateTable(table string, columns []string) string {
+	definitions := make([]string, len(columns))
+
+	for i, column := range columns {
+		definitions[i] = strings.Replace(column, " TEXT", " NVARCHAR(MAX)", 1)
+	}
+
+	return "IF OBJECT_ID(N'" + strings.ReplaceAll(table, "'", "''") + "', N'U') IS NULL CREATE TABLE " + table + " (id INT IDENTITY(1,1) PRIMARY KEY, " + strings.Join(definitions, ", ") + ");"
+}
+
+func (SQLServerDialect) ColumnExists(schema, table, column string) (string, []any) {
+	return "SELECT COUNT(*) FROM information_schema.columns WHERE table_schema = COALESCE(NULLIF(@p1, ''), SCHEMA_NAME()) AND table_name = @p2 AND column_name = @p3", []any{schema, table, column}
+}
+
+func (SQLServerDialect) AddColumn(table, column string) string {
+	return "ALTER TABLE " + table + " ADD " + column
+}
+
+/*
+Lock acquires a session owned application lock with sp_getapplock, the lock is
+held by a dedicated connection and is automatically released by SQL Server if
+the connection is lost.
+*/
+func (d SQLServerDialect) Lock(ctx context.Context, db *sql.DB, schema, table string, timeout time.Duration) (func(context.Context) error, error) {
+	resource := "migrate:" + d.QuoteIdent(table)
+
+	if schema != "" {
+		resource = "migrate:" + d.QuoteIdent(schema) + "." + d.QuoteIdent(table)
+	}
+
+	acquire := func(conn *sql.Conn) error {
+		var result int
+
+		err := conn.QueryRowContext(ctx, "DECLARE @result INT; EXEC @result = sp_getapplock @Resource = @p1, @LockMode = 'Exclusive', @LockOwner = 'Session', @LockTimeout = @p2; SELECT @result", resource, timeout.Milliseconds()).Scan(&result)
+
+		if err != nil {
+			return fmt.Errorf("unable to acquire lock: %w", err)
+		}
+
+		// 0 and 1 indicate the lock was granted, -1 that the request timed out
+		switch result {
+		case 0, 1:
+			return nil
+		case -1:
+			return ErrLockTimeout
+		case -2:
+			return errors.New("unable to acquire lock: the lock request was cancelled")
+		case -3:
+			return errors.New("unable to acquire lock: the lock request was chosen as a deadlock victim")
+		}
+
+		return fmt.Errorf("unable to acquire lock: sp_getapplock returned %d (parameter validation or call error)", result)
+	}
+
+	release := func(ctx context.Context, conn *sql.Conn) error {
+		_, err := conn.ExecContext(ctx, "EXEC sp_releaseapplock @Resource = @p1, @LockOwner = 'Session'", resource)
+
+		return err
+	}
+
+	return sessionLock(ctx, db, acquire, release)
+}
@@ -0,0 +1,88 @@
+package migrate_test
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/jameswhoughton/migrate"
+)
+
+// SQLite with numbered placeholders (`?NNN`), standing in for a third-party dialect
+type numberedSQLiteDialect struct {
+	migrate.SQLiteDialect
+}
+
+func (numberedSQLiteDialect) Placeholder(n int) string {
+	return "?" + strconv.Itoa(n)
+}
+
+// NewLogSQL() uses the SQL of the given dialect for every operation
+func TestLogSQLWithCustomDialect(t *testing.T) {
+	db, tearDown, err := sqliteDb()
+	defer tearDown()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	migrationLog, err := migrate.NewLogSQL(db, numberedSQLiteDialect{}, migrate.WithHistory())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, m := range []migrate.Migration{{Name: "a", Step: 1}, {Name: "b", Step: 2}} {
+		if err := migrationLog.Add(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if !migrationLog.Contains("b") || migrationLog.Contains("c") {
+		t.Error("Contains() returned the wrong result")
+	}
+
+	if step := migrationLog.LastStep(); step != 2 {
+		t.Errorf("Expected last step 2, got %d", step)
+	}
+
+	m, err := migrationLog.Pop()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Name != "b" {
+		t.Errorf("Expected to pop b, got %s", m.Name)
+	}
+
+	err = migrationLog.Lock(context.Background())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = migrationLog.Unlock(context.Background())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testDirtyRoundTrip(t, &migrationLog)
+	testHistoryRoundTrip(t, &migrationLog)
+}
+
+// The SQL Server dialect creates tables with an identity id and without TEXT columns
+func TestSQLServerDialectCreateTable(t *testing.T) {
+	dialect := migrate.SQLServerDialect{}
+
+	table := dialect.QuoteIdent("dbo") + "." + dialect.QuoteIdent("app's]migrations")
+
+	expected := "IF OBJECT_ID(N'[dbo].[app''s]]migrations]', N'U') IS NULL CREATE TABLE [dbo].[app's]]migrations] (id INT IDENTITY(1,1) PRIMARY KEY, name VARCHAR(255) NOT NULL, error_message NVARCHAR(MAX) NOT NULL);"
+
+	got := dialect.CreateTable(table, []string{"name VARCHAR(255) NOT NULL", "error_message TEXT NOT NULL"})
+
+	if got != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, got)
+	}
+}
@@ -1,93 +1,135 @@
 package migrate
 
 import (
+	"context"
 	"database/sql"
-	"errors"
 	"fmt"
+	"strings"
+	"time"
 )
 
-type LogSQLite struct {
-	db *sql.DB
+// SQLiteDialect is the Dialect of SQLite
+type SQLiteDialect struct{}
+
+func (SQLiteDialect) QuoteIdent(name string) string {
+	return quoteIdent(name)
+}
+
+func (SQLiteDialect) Placeholder(n int) string {
+	return "?"
 }
 
-func (d *LogSQLite) Init() error {
-	_, err := d.db.Exec("CREATE TABLE IF NOT EXISTS migrations (id INTEGER PRIMARY KEY AUTOINCREMENT, name VARCHAR(100) NOT NULL, step INTEGER NOT NULL);")
+func (SQLiteDialect) CreateTable(table string, columns []string) string {
+	return "CREATE TABLE IF NOT EXISTS " + table + " (id INTEGER PRIMARY KEY AUTOINCREMENT, " + strings.Join(columns, ", ") + ");"
+}
 
-	if err != nil {
-		return fmt.Errorf("could not create migrations table: %w", err)
+func (SQLiteDialect) ColumnExists(schema, table, column string) (string, []any) {
+	if schema == "" {
+		schema = "main"
 	}
 
-	return nil
+	return "SELECT COUNT(*) FROM pragma_table_info(?, ?) WHERE name = ?", []any{table, schema, column}
+}
+
+func (SQLiteDialect) AddColumn(table, column string) string {
+	return "ALTER TABLE " + table + " ADD COLUMN " + column
 }
 
-func (d *LogSQLite) Add(m Migration) error {
-	_, err := d.db.Exec("INSERT INTO migrations (name, step) VALUES (?, ?)", m.Name, m.Step)
+/*
+Lock acquires the migration lock by inserting the single row of the
+`{table}_lock` table, waiting for the row to be removed if another process
+holds the lock. If a process is killed while holding the lock, the row must
+be removed with ForceUnlock.
+*/
+func (SQLiteDialect) Lock(ctx context.Context, db *sql.DB, schema, table string, timeout time.Duration) (func(context.Context) error, error) {
+	lockTable, err := createSQLiteLockTable(ctx, db, schema, table)
 
 	if err != nil {
-		return fmt.Errorf("unable to insert migration: %w", err)
+		return nil, err
 	}
 
-	return nil
-}
+	err = pollLock(ctx, timeout, func() (bool, error) {
+		result, err := db.ExecContext(ctx, "INSERT OR IGNORE INTO "+lockTable+" (id, locked_at) VALUES (1, ?)", time.Now().Format(time.RFC3339))
 
-func (d *LogSQLite) Pop() (Migration, error) {
-	row := d.db.QueryRow("SELECT id, name, step FROM migrations ORDER BY id DESC LIMIT 1")
+		if err != nil {
+			return false, fmt.Errorf("unable to acquire lock: %w", err)
+		}
 
-	var id int
-	var name string
-	var step int
+		inserted, err := result.RowsAffected()
 
-	err := row.Scan(&id, &name, &step)
+		if err != nil {
+			return false, fmt.Errorf("unable to acquire lock: %w", err)
+		}
+
+		return inserted == 1, nil
+	})
 
 	if err != nil {
-		return Migration{}, fmt.Errorf("unable to parse row: %w", err)
+		return nil, err
 	}
 
-	// Remove row
-	d.db.Exec("DELETE FROM migrations WHERE id = ?", id)
+	return func(ctx context.Context) error {
+		_, err := db.ExecContext(ctx, "DELETE FROM "+lockTable+" WHERE id = 1")
+
+		if err != nil {
+			return fmt.Errorf("unable to release lock: %w", err)
+		}
 
-	return Migration{
-		Name: name,
-		Step: step,
+		return nil
 	}, nil
 }
 
-func (d *LogSQLite) Contains(name string) bool {
-	row := d.db.QueryRow("SELECT id FROM migrations WHERE name = ?", name)
+// ForceUnlock removes the row of the `{table}_lock` table whichever process inserted it
+func (SQLiteDialect) ForceUnlock(ctx context.Context, db *sql.DB, schema, table string) error {
+	lockTable, err := createSQLiteLockTable(ctx, db, schema, table)
+
+	if err != nil {
+		return err
+	}
 
-	err := row.Scan()
+	_, err = db.ExecContext(ctx, "DELETE FROM "+lockTable+" WHERE id = 1")
 
-	if err != nil && errors.Is(err, sql.ErrNoRows) {
-		return false
+	if err != nil {
+		return fmt.Errorf("unable to release lock: %w", err)
 	}
 
-	return true
+	return nil
 }
 
-func (d *LogSQLite) LastStep() int {
-	row := d.db.QueryRow("SELECT step FROM migrations ORDER BY id DESC")
+// Creates the lock table (if it doesn't already exist) and returns its quoted name
+func createSQLiteLockTable(ctx context.Context, db *sql.DB, schema, table string) (string, error) {
+	lockTable := quoteIdent(table + "_lock")
 
-	var step int
+	if schema != "" {
+		lockTable = quoteIdent(schema) + "." + lockTable
+	}
 
-	err := row.Scan(&step)
+	_, err := db.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS "+lockTable+" (id INTEGER PRIMARY KEY CHECK (id = 1), locked_at TEXT NOT NULL);")
 
 	if err != nil {
-		return 0
+		return "", fmt.Errorf("could not create lock table: %w", err)
 	}
 
-	return step
+	return lockTable, nil
 }
 
-func NewLogSQLite(db *sql.DB) (LogSQLite, error) {
-	log := LogSQLite{
-		db: db,
-	}
+// LogSQLite is a LogSQL using the SQLiteDialect
+type LogSQLite struct {
+	LogSQL
+}
 
-	err := log.Init()
+/*
+NewLogSQLite creates the migrations table (if it doesn't already exist) and
+returns the log. The table can be renamed with the WithTableName option (or
+stored in an attached database with WithSchema) and every apply and rollback
+can also be recorded in a history table with the WithHistory option.
+*/
+func NewLogSQLite(db *sql.DB, opts ...LogOption) (LogSQLite, error) {
+	log, err := NewLogSQL(db, SQLiteDialect{}, opts...)
 
 	if err != nil {
-		return LogSQLite{}, fmt.Errorf("failed to create MySQL log: %w", err)
+		return LogSQLite{}, fmt.Errorf("failed to create SQLite log: %w", err)
 	}
 
-	return log, nil
+	return LogSQLite{log}, nil
 }
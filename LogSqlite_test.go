@@ -1,9 +1,12 @@
 package migrate_test
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/jameswhoughton/migrate"
 	_ "github.com/mattn/go-sqlite3"
@@ -60,9 +63,9 @@ func TestSQLiteContainsReturnsTheCorrectResult(t *testing.T) {
 		{
 			name: "search in list",
 			migrations: []migrate.Migration{
-				{"a", 0},
-				{"b", 0},
-				{"c", 0},
+				{Name: "a", Step: 0},
+				{Name: "b", Step: 0},
+				{Name: "c", Step: 0},
 			},
 			search:   "a",
 			expected: true,
@@ -76,8 +79,8 @@ func TestSQLiteContainsReturnsTheCorrectResult(t *testing.T) {
 		{
 			name: "partial search",
 			migrations: []migrate.Migration{
-				{"migration A", 0},
-				{"migration B", 0},
+				{Name: "migration A", Step: 0},
+				{Name: "migration B", Step: 0},
 			},
 			search:   "migration",
 			expected: false,
@@ -85,8 +88,8 @@ func TestSQLiteContainsReturnsTheCorrectResult(t *testing.T) {
 		{
 			name: "different steps",
 			migrations: []migrate.Migration{
-				{"migration A", 0},
-				{"migration B", 1},
+				{Name: "migration A", Step: 0},
+				{Name: "migration B", Step: 1},
 			},
 			search:   "migration B",
 			expected: true,
@@ -148,8 +151,8 @@ func TestSQLiteAddInsertsMigrationIntoTable(t *testing.T) {
 	expectedStep := 3
 
 	err = log.Add(migrate.Migration{
-		expectedName,
-		expectedStep,
+		Name: expectedName,
+		Step: expectedStep,
 	})
 
 	if err != nil {
@@ -175,7 +178,7 @@ func TestSQLiteAddInsertsMigrationIntoTable(t *testing.T) {
 			t.Fatal(err)
 		}
 
-		migrations = append(migrations, migrate.Migration{name, step})
+		migrations = append(migrations, migrate.Migration{Name: name, Step: step})
 	}
 
 	if len(migrations) != 1 {
@@ -259,16 +262,16 @@ func TestSQLiteLastStepReturnsNextAvaiableIndex(t *testing.T) {
 
 	migrations := []migrate.Migration{
 		{
-			"aaa",
-			4,
+			Name: "aaa",
+			Step: 4,
 		},
 		{
-			"bbb",
-			5,
+			Name: "bbb",
+			Step: 5,
 		},
 		{
-			"ccc",
-			5,
+			Name: "ccc",
+			Step: 5,
 		},
 	}
 
@@ -286,3 +289,387 @@ func TestSQLiteLastStepReturnsNextAvaiableIndex(t *testing.T) {
 		t.Fatalf("Expected %d got %d", expected, actual)
 	}
 }
+
+func TestSQLiteListReturnsMigrationsInOrder(t *testing.T) {
+	db, tearDown, err := sqliteDb()
+	defer tearDown()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log, err := migrate.NewLogSQLite(db)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []migrate.Migration{
+		{Name: "ccc", Step: 1},
+		{Name: "aaa", Step: 1},
+		{Name: "bbb", Step: 2},
+	}
+
+	for _, m := range expected {
+		_, err = db.Exec("INSERT INTO migrations (name, step) VALUES (?, ?);", m.Name, m.Step)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	migrations, err := log.List()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(migrations) != len(expected) {
+		t.Fatalf("Expected %d migrations, got %d", len(expected), len(migrations))
+	}
+
+	for i, m := range expected {
+		if migrations[i] != m {
+			t.Errorf("Expected %v, got %v", m, migrations[i])
+		}
+	}
+}
+
+// NewLogSQLite() adds the checksum column to tables created by earlier versions
+func TestNewLogSQLiteUpgradesExistingTable(t *testing.T) {
+	db, tearDown, err := sqliteDb()
+	defer tearDown()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = db.Exec("CREATE TABLE migrations (id INTEGER PRIMARY KEY AUTOINCREMENT, name VARCHAR(100) NOT NULL, step INTEGER NOT NULL);")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = db.Exec("INSERT INTO migrations (name, step) VALUES ('aaa', 1);")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log, err := migrate.NewLogSQLite(db)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = log.Add(migrate.Migration{Name: "bbb", Step: 2, Checksum: "abc"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	migrations, err := log.List()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []migrate.Migration{{Name: "aaa", Step: 1}, {Name: "bbb", Step: 2, Checksum: "abc"}}
+
+	if len(migrations) != len(expected) {
+		t.Fatalf("Expected %d migrations, got %d", len(expected), len(migrations))
+	}
+
+	for i, m := range expected {
+		if migrations[i] != m {
+			t.Errorf("Expected %v, got %v", m, migrations[i])
+		}
+	}
+}
+
+// Lock() times out while another log instance holds the lock
+func TestSQLiteLockTimesOutWhenLocked(t *testing.T) {
+	db, tearDown, err := sqliteDb()
+	defer tearDown()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := migrate.NewLogSQLite(db)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := migrate.NewLogSQLite(db)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second.LockTimeout = 200 * time.Millisecond
+
+	err = first.Lock(context.Background())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = second.Lock(context.Background())
+
+	if !errors.Is(err, migrate.ErrLockTimeout) {
+		t.Fatalf("Expected ErrLockTimeout, got %v", err)
+	}
+
+	err = first.Unlock(context.Background())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = second.Lock(context.Background())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second.Unlock(context.Background())
+}
+
+// ForceUnlock() releases a lock left behind by a process which never unlocked it
+func TestSQLiteForceUnlockReleasesStaleLock(t *testing.T) {
+	db, tearDown, err := sqliteDb()
+	defer tearDown()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	crashed, err := migrate.NewLogSQLite(db)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log, err := migrate.NewLogSQLite(db)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log.LockTimeout = 200 * time.Millisecond
+
+	// The crashed process never calls Unlock
+	err = crashed.Lock(context.Background())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = log.Lock(context.Background())
+
+	if !errors.Is(err, migrate.ErrLockTimeout) {
+		t.Fatalf("Expected ErrLockTimeout, got %v", err)
+	}
+
+	err = migrate.ForceUnlock(&log)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = log.Lock(context.Background())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log.Unlock(context.Background())
+}
+
+// SetDirty() records the migration in flight until ClearDirty() is called
+func TestSQLiteDirtyRoundTrip(t *testing.T) {
+	db, tearDown, err := sqliteDb()
+	defer tearDown()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	migrationLog, err := migrate.NewLogSQLite(db)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testDirtyRoundTrip(t, &migrationLog)
+}
+
+// NewLogSQLite() adds the metadata columns to tables created by earlier versions and the metadata is persisted
+func TestSQLiteMetadataIsPersisted(t *testing.T) {
+	db, tearDown, err := sqliteDb()
+	defer tearDown()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = db.Exec("CREATE TABLE migrations (id INTEGER PRIMARY KEY AUTOINCREMENT, name VARCHAR(100) NOT NULL, step INTEGER NOT NULL, checksum VARCHAR(64) NOT NULL DEFAULT '');")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = db.Exec("INSERT INTO migrations (name, step, checksum) VALUES ('aaa', 1, 'abc');")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log, err := migrate.NewLogSQLite(db)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	applied := migrate.Migration{
+		Name:      "bbb",
+		Step:      2,
+		Checksum:  "def",
+		AppliedAt: time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC),
+		Duration:  1500 * time.Millisecond,
+		Executor:  "deploy@ci",
+		Label:     "v1.2.0",
+	}
+
+	err = log.Add(applied)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	migrations, err := log.List()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []migrate.Migration{{Name: "aaa", Step: 1, Checksum: "abc"}, applied}
+
+	if len(migrations) != len(expected) {
+		t.Fatalf("Expected %d migrations, got %d", len(expected), len(migrations))
+	}
+
+	for i, m := range expected {
+		if migrations[i] != m {
+			t.Errorf("Expected %v, got %v", m, migrations[i])
+		}
+	}
+
+	popped, err := log.Pop()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if popped != applied {
+		t.Errorf("Expected %v, got %v", applied, popped)
+	}
+}
+
+// History() returns the events added with AddHistory() selected by the filter
+func TestSQLiteHistoryRoundTrip(t *testing.T) {
+	db, tearDown, err := sqliteDb()
+	defer tearDown()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	migrationLog, err := migrate.NewLogSQLite(db, migrate.WithHistory())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testHistoryRoundTrip(t, &migrationLog)
+}
+
+// WithTableName() and WithSchema() keep independent logs in separate (quoted) tables
+func TestSQLiteTableNameAndSchemaOptions(t *testing.T) {
+	db, tearDown, err := sqliteDb()
+	defer tearDown()
+	defer os.Remove("reporting.db")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Attached databases are per connection
+	db.SetMaxOpenConns(1)
+
+	_, err = db.Exec("ATTACH DATABASE 'reporting.db' AS reporting")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app, err := migrate.NewLogSQLite(db, migrate.WithTableName(`app "migrations"`))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reporting, err := migrate.NewLogSQLite(db, migrate.WithSchema("reporting"), migrate.WithTableName("migrations"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = app.Add(migrate.Migration{Name: "app", Step: 1})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = reporting.Add(migrate.Migration{Name: "reporting", Step: 1})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !tableExists(db, `app "migrations"`) || !tableExists(db, `app "migrations"_dirty`) {
+		t.Fatal("Expected the renamed tables to be created")
+	}
+
+	if tableExists(db, "migrations") {
+		t.Fatal("Expected the default table not to be created in the main database")
+	}
+
+	if !app.Contains("app") || app.Contains("reporting") {
+		t.Error("Expected the app log to only contain app")
+	}
+
+	if !reporting.Contains("reporting") || reporting.Contains("app") {
+		t.Error("Expected the reporting log to only contain reporting")
+	}
+
+	err = app.Lock(context.Background())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer app.Unlock(context.Background())
+
+	reporting.LockTimeout = 200 * time.Millisecond
+
+	err = reporting.Lock(context.Background())
+
+	if err != nil {
+		t.Fatalf("Expected the logs to be locked independently, got %v", err)
+	}
+
+	reporting.Unlock(context.Background())
+}
@@ -0,0 +1,147 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/user"
+	"time"
+)
+
+type contextKey int
+
+const (
+	executorKey contextKey = iota
+	labelKey
+)
+
+/*
+WithExecutor returns a context which records the given identity (e.g. the name
+of the CI job) as the executor of the migrations applied with it, by default
+the executor is `{user}@{host}` of the current process.
+*/
+func WithExecutor(ctx context.Context, executor string) context.Context {
+	return context.WithValue(ctx, executorKey, executor)
+}
+
+/*
+WithLabel returns a context which records the given free-form label (e.g. the
+version of the application being deployed) with the migrations applied with it.
+*/
+func WithLabel(ctx context.Context, label string) context.Context {
+	return context.WithValue(ctx, labelKey, label)
+}
+
+// Returns the executor set with WithExecutor, falling back to {user}@{host}
+func executorFromContext(ctx context.Context) string {
+	if executor, ok := ctx.Value(executorKey).(string); ok {
+		return executor
+	}
+
+	username := os.Getenv("USER")
+
+	if current, err := user.Current(); err == nil {
+		username = current.Username
+	}
+
+	host, _ := os.Hostname()
+
+	return username + "@" + host
+}
+
+func labelFromContext(ctx context.Context) string {
+	label, _ := ctx.Value(labelKey).(string)
+
+	return label
+}
+
+/*
+Records when (and by whom) the migration was applied and how long it took. The
+time is stored to the second and the duration to the millisecond so the values
+are unchanged when read back from the log.
+*/
+func stampMigration(ctx context.Context, m *Migration, appliedAt time.Time, duration time.Duration) {
+	m.AppliedAt = appliedAt.UTC().Truncate(time.Second)
+	m.Duration = duration.Truncate(time.Millisecond)
+	m.Executor = executorFromContext(ctx)
+	m.Label = labelFromContext(ctx)
+}
+
+func formatAppliedAt(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	return t.Format(time.RFC3339)
+}
+
+// Migrations logged before the applied time was recorded have an empty value
+func parseAppliedAt(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid applied at '%s': %w", value, err)
+	}
+
+	return t, nil
+}
+
+// A column added to the migrations table after it was first released
+type logColumn struct {
+	name       string
+	definition string
+}
+
+/*
+Columns added to the migrations table since the first release, the SQL log
+drivers add any which are missing when the log is initialised so tables created
+by earlier versions are upgraded in place.
+*/
+var logUpgradeColumns = []logColumn{
+	{"checksum", "VARCHAR(64) NOT NULL DEFAULT ''"},
+	{"applied_at", "VARCHAR(35) NOT NULL DEFAULT ''"},
+	{"duration_ms", "BIGINT NOT NULL DEFAULT 0"},
+	{"executor", "VARCHAR(255) NOT NULL DEFAULT ''"},
+	{"label", "VARCHAR(255) NOT NULL DEFAULT ''"},
+}
+
+// Columns read and written by the SQL log drivers, see scanMigration and migrationValues
+const migrationColumns = "name, step, checksum, applied_at, duration_ms, executor, label"
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// Scans a row of migrationColumns, prefix is scanned before the migration columns (e.g. the id)
+func scanMigration(row rowScanner, prefix ...any) (Migration, error) {
+	var m Migration
+	var appliedAt string
+	var durationMs int64
+
+	dest := append(prefix, &m.Name, &m.Step, &m.Checksum, &appliedAt, &durationMs, &m.Executor, &m.Label)
+
+	if err := row.Scan(dest...); err != nil {
+		return Migration{}, err
+	}
+
+	var err error
+
+	m.AppliedAt, err = parseAppliedAt(appliedAt)
+
+	if err != nil {
+		return Migration{}, err
+	}
+
+	m.Duration = time.Duration(durationMs) * time.Millisecond
+
+	return m, nil
+}
+
+// Values of migrationColumns for the migration
+func migrationValues(m Migration) []any {
+	return []any{m.Name, m.Step, m.Checksum, formatAppliedAt(m.AppliedAt), m.Duration.Milliseconds(), m.Executor, m.Label}
+}
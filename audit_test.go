@@ -0,0 +1,91 @@
+package migrate_test
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/jameswhoughton/migrate"
+)
+
+// MigrateContext() should record when, how quickly and by whom each migration was applied
+func TestMigrateRecordsMetadata(t *testing.T) {
+	db, _ := sql.Open("sqlite3", "test.db")
+	defer os.Remove("test.db")
+
+	log, err := migrate.NewLogSQLite(db)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testFs := fstest.MapFS{
+		"1_migration_up.sql": {Data: []byte("CREATE TABLE users (id INT);")},
+		"2_migration_up.sql": {Data: []byte("-- migrate:no-transaction\nCREATE TABLE posts (id INT);")},
+	}
+
+	ctx := migrate.WithLabel(migrate.WithExecutor(context.Background(), "deploy@ci"), "v1.2.0")
+	before := time.Now().UTC().Truncate(time.Second)
+
+	err = migrate.MigrateContext(ctx, db, testFs, &log)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	migrations, err := log.List()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(migrations) != 2 {
+		t.Fatalf("Expected 2 migrations, got %d", len(migrations))
+	}
+
+	for _, m := range migrations {
+		if m.AppliedAt.Before(before) || m.AppliedAt.After(time.Now()) {
+			t.Errorf("Expected %s to be applied after %s, got %s", m.Name, before, m.AppliedAt)
+		}
+
+		if m.Duration < 0 {
+			t.Errorf("Expected %s duration to be positive, got %s", m.Name, m.Duration)
+		}
+
+		if m.Executor != "deploy@ci" || m.Label != "v1.2.0" {
+			t.Errorf("Expected %s executor deploy@ci and label v1.2.0, got %s and %s", m.Name, m.Executor, m.Label)
+		}
+	}
+}
+
+// Migrate() should record {user}@{host} as the executor by default
+func TestMigrateRecordsDefaultExecutor(t *testing.T) {
+	db, _ := sql.Open("sqlite3", "test.db")
+	defer os.Remove("test.db")
+
+	log := newTestLog()
+
+	testFs := fstest.MapFS{
+		"1_migration_up.sql": {Data: []byte("CREATE TABLE users (id INT);")},
+	}
+
+	err := migrate.Migrate(db, testFs, &log)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	host, _ := os.Hostname()
+
+	if executor := log.store[0].Executor; !strings.HasSuffix(executor, "@"+host) {
+		t.Errorf("Expected executor to end with @%s, got %s", host, executor)
+	}
+
+	if log.store[0].Label != "" {
+		t.Errorf("Expected no label, got %s", log.store[0].Label)
+	}
+}
@@ -0,0 +1,116 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"time"
+)
+
+/*
+Baseline marks every pending migration up to and including `upTo` as applied
+without executing it, this is used when adopting the library on a database
+which already has the schema (so that Migrate doesn't try to run the historic
+migrations again).
+
+The target is matched in the same way as MigrateTo (full name, file name or
+prefix). The migrations are added to the log (with their checksums) in a new
+step, if there are no pending migrations up to the target the log is unchanged.
+ErrMigrationNotFound is returned if no migration matches the target and ErrDirty
+if the log is dirty.
+*/
+func Baseline(directory fs.FS, log MigrationLog, upTo string) error {
+	return BaselineContext(context.Background(), directory, log, upTo)
+}
+
+// BaselineContext is the same as Baseline but accepts a context.
+func BaselineContext(ctx context.Context, directory fs.FS, log MigrationLog, upTo string) error {
+	return withLock(ctx, log, func() error {
+		if err := checkClean(ctx, log); err != nil {
+			return fmt.Errorf("Baseline: %w", err)
+		}
+
+		migrations, err := pendingMigrationsTo(ctx, directory, log, upTo)
+
+		if err != nil {
+			return fmt.Errorf("Baseline: %w", err)
+		}
+
+		step := logLastStep(ctx, log) + 1
+
+		for _, pending := range migrations {
+			up, err := upScript(directory, pending)
+
+			if err != nil {
+				return fmt.Errorf("Baseline: unable to read migration '%s': %w", pending.file, err)
+			}
+
+			m := Migration{
+				Name:     pending.name,
+				Step:     step,
+				Checksum: up.checksum,
+			}
+
+			stampMigration(ctx, &m, time.Now(), 0)
+
+			err = logAdd(ctx, log, m)
+
+			if err != nil {
+				return fmt.Errorf("Baseline: unable to add migration '%s' to log: %w", pending.name, err)
+			}
+		}
+
+		return nil
+	})
+}
+
+/*
+Seed adds the named migrations to the log in a single new step without executing
+them, names which are already in the log are skipped. Unlike Baseline the
+migrations don't need to exist in a directory and are logged without a checksum
+(so they are not checked by Verify), this is used by the importer to add the
+migrations applied by another tool. The added entries are returned.
+
+ErrDirty is returned if the log is dirty.
+*/
+func Seed(log MigrationLog, names []string) ([]Migration, error) {
+	return SeedContext(context.Background(), log, names)
+}
+
+// SeedContext is the same as Seed but accepts a context.
+func SeedContext(ctx context.Context, log MigrationLog, names []string) ([]Migration, error) {
+	added := []Migration{}
+
+	err := withLock(ctx, log, func() error {
+		if err := checkClean(ctx, log); err != nil {
+			return fmt.Errorf("Seed: %w", err)
+		}
+
+		step := logLastStep(ctx, log) + 1
+
+		for _, name := range names {
+			if logContains(ctx, log, name) {
+				continue
+			}
+
+			m := Migration{
+				Name: name,
+				Step: step,
+			}
+
+			stampMigration(ctx, &m, time.Now(), 0)
+
+			err := logAdd(ctx, log, m)
+
+			if err != nil {
+				return fmt.Errorf("Seed: unable to add migration '%s' to log: %w", name, err)
+			}
+
+			added = append(added, m)
+		}
+
+		return nil
+	})
+
+	return added, err
+}
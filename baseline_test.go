@@ -0,0 +1,104 @@
+package migrate_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"testing"
+	"testing/fstest"
+
+	"github.com/jameswhoughton/migrate"
+)
+
+// Baseline() marks migrations up to the target as applied without running them
+func TestBaselineMarksMigrationsAsApplied(t *testing.T) {
+	db, _ := sql.Open("sqlite3", "test.db")
+	defer os.Remove("test.db")
+
+	log := newTestLog()
+
+	testFs := fstest.MapFS{
+		"1_migrationA_up.sql": {Data: []byte("I am not a valid query")},
+		"2_migrationB.sql":    {Data: []byte("I am not a valid query")},
+		"3_migrationC_up.sql": {Data: []byte("CREATE TABLE users (id INT PRIMARY KEY)")},
+	}
+
+	err := migrate.Baseline(testFs, &log, "2")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(log.store) != 2 {
+		t.Fatalf("Expected 2 migrations in the log, found %v", log.store)
+	}
+
+	for _, m := range log.store {
+		if m.Step != 1 || m.Checksum == "" {
+			t.Fatalf("Expected migrations to be logged in step 1 with a checksum, found %v", log.store)
+		}
+	}
+
+	// Only the migration after the baseline should run
+	err = migrate.Migrate(db, testFs, &log)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(log.store) != 3 || log.store[2].Name != "3_migrationC" || log.store[2].Step != 2 {
+		t.Fatalf("Expected 3_migrationC to run in step 2, found %v", log.store)
+	}
+}
+
+// Baseline() returns ErrMigrationNotFound if the target doesn't exist
+func TestBaselineReturnsErrorIfTargetMissing(t *testing.T) {
+	log := newTestLog()
+
+	testFs := fstest.MapFS{
+		"1_migrationA_up.sql": {Data: []byte("")},
+	}
+
+	err := migrate.Baseline(testFs, &log, "2")
+
+	if !errors.Is(err, migrate.ErrMigrationNotFound) {
+		t.Fatalf("Expected ErrMigrationNotFound, got %v", err)
+	}
+
+	if len(log.store) != 0 {
+		t.Fatalf("Expected log to be empty, found %v", log.store)
+	}
+}
+
+// Baseline() refuses to run while the log is dirty
+func TestBaselineReturnsErrorIfLogDirty(t *testing.T) {
+	db, _ := sql.Open("sqlite3", "test.db")
+	defer os.Remove("test.db")
+
+	log, err := migrate.NewLogSQLite(db)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = log.SetDirty(context.Background(), migrate.DirtyMigration{Name: "1_migrationA", Direction: migrate.DirectionUp, Step: 1})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testFs := fstest.MapFS{
+		"1_migrationA_up.sql": {Data: []byte("")},
+	}
+
+	err = migrate.Baseline(testFs, &log, "1")
+
+	if !errors.Is(err, migrate.ErrDirty) {
+		t.Fatalf("Expected ErrDirty, got %v", err)
+	}
+
+	if log.Contains("1_migrationA") {
+		t.Fatal("Expected the log to be unchanged")
+	}
+}
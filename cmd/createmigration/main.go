@@ -13,10 +13,14 @@ The optional `--dir` option specifies the directory to create the scripts (relat
 to the run path), the default value is 'migrations'.
 
 The optional `--pair` option will create both a migration and a rollback script.
+
+The optional `--single` option will create a single script containing both an up
+and a down section, for example 444_create_users_table.sql.
 */
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"log"
@@ -29,9 +33,14 @@ import (
 
 var dirFlag = flag.String("dir", "migrations", "set the directory in which to create migrations (default: migrations)")
 var createPairFlag = flag.Bool("pair", false, "create a pair of migrations (up and down)")
+var singleFlag = flag.Bool("single", false, "create a single migration with up and down sections")
 var helpFlag = flag.Bool("help", false, "help")
 
-func run(directory, name string, createPair bool) error {
+func run(directory, name string, createPair, single bool) error {
+	if createPair && single {
+		return errors.New("--pair and --single cannot be used together")
+	}
+
 	if _, err := os.Stat(directory); os.IsNotExist(err) {
 		err := os.Mkdir(directory, 0755)
 
@@ -42,6 +51,18 @@ func run(directory, name string, createPair bool) error {
 
 	timestamp := strconv.FormatInt(time.Now().UnixNano(), 10)
 
+	if single {
+		migration, err := migrate.MakeSingleMigration(directory, name, timestamp)
+
+		if err != nil {
+			return fmt.Errorf("migration %s could not be created: %v", name, err)
+		}
+
+		fmt.Printf("migration created: %s\n", migration)
+
+		return nil
+	}
+
 	suffix := ""
 
 	if createPair {
@@ -81,11 +102,13 @@ Description
   compatible with https://github.com/jameswhoughton/migrate
 
 Usage:
-  createmigration [--pair] [--dir=] name
+  createmigration [--pair|--single] [--dir=] name
 
 Flags:
   --pair	Create both a migration and a rollback script, 
 		if omitted, only the migration will be created.
+  --single	Create a single script containing both the migration
+		(-- migrate:up) and rollback (-- migrate:down) sections.
   --dir		Specify the directory in which to save the scripts,
 		the path should be relative to the command location.
 		The default value is 'migrations'.
@@ -107,7 +130,7 @@ func main() {
 
 	name := flag.Args()[0]
 
-	err := run(*dirFlag, name, *createPairFlag)
+	err := run(*dirFlag, name, *createPairFlag, *singleFlag)
 
 	if err != nil {
 		log.Fatalln(err)
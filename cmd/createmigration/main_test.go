@@ -2,6 +2,8 @@ package main
 
 import (
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -11,9 +13,32 @@ const MIGRATION_DIR = "migrations_test"
 func TestCreatesMigrationDirectoryIfMissing(t *testing.T) {
 	defer os.RemoveAll(MIGRATION_DIR)
 
-	run(MIGRATION_DIR, "test", false)
+	run(MIGRATION_DIR, "test", false, false)
 
 	if _, err := os.Stat(MIGRATION_DIR); os.IsNotExist(err) {
 		t.Fatal("migrations directory not found")
 	}
 }
+
+// --single creates one migration containing up and down sections
+func TestSingleCreatesMigrationWithSections(t *testing.T) {
+	defer os.RemoveAll(MIGRATION_DIR)
+
+	err := run(MIGRATION_DIR, "test", false, true)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files, _ := os.ReadDir(MIGRATION_DIR)
+
+	if len(files) != 1 || !strings.HasSuffix(files[0].Name(), "_test.sql") {
+		t.Fatalf("Expected a single migration, got %v", files)
+	}
+
+	content, _ := os.ReadFile(filepath.Join(MIGRATION_DIR, files[0].Name()))
+
+	if !strings.Contains(string(content), "-- migrate:up") || !strings.Contains(string(content), "-- migrate:down") {
+		t.Fatalf("Expected up and down sections, got %q", content)
+	}
+}
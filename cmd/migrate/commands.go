@@ -0,0 +1,614 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/jameswhoughton/migrate"
+	"github.com/jameswhoughton/migrate/importer"
+)
+
+// A CLI subcommand, args excludes the command name
+type command func(args []string, out io.Writer) error
+
+var commands = map[string]command{
+	"up":       up,
+	"down":     down,
+	"status":   status,
+	"redo":     redo,
+	"reset":    reset,
+	"create":   create,
+	"verify":   verify,
+	"import":   importMigrations,
+	"baseline": baseline,
+	"history":  history,
+	"copy-log": copyLog,
+
+	"mark-applied":   markApplied,
+	"mark-unapplied": markUnapplied,
+	"force-step":     forceStep,
+	"renumber":       renumber,
+	"force-clean":    forceClean,
+	"force-unlock":   forceUnlock,
+}
+
+// Connection, directory and log required by most commands
+type environment struct {
+	ctx       context.Context
+	db        *sql.DB
+	directory fs.FS
+	log       migrate.MigrationLog
+}
+
+// Parses the flags and opens the database and log
+func setup(flags *flag.FlagSet, cfg *config, args []string) (environment, error) {
+	err := flags.Parse(args)
+
+	if err != nil {
+		return environment{}, err
+	}
+
+	db, err := cfg.openDB()
+
+	if err != nil {
+		return environment{}, err
+	}
+
+	log, err := cfg.openLog(db)
+
+	if err != nil {
+		db.Close()
+
+		return environment{}, err
+	}
+
+	return environment{
+		ctx:       cfg.context(),
+		db:        db,
+		directory: os.DirFS(cfg.dir),
+		log:       log,
+	}, nil
+}
+
+func up(args []string, out io.Writer) error {
+	var cfg config
+
+	flags := newFlagSet("up", &cfg, out)
+	dryRun := flags.Bool("dry-run", false, "print the migrations that would run without executing them")
+	to := flags.String("to", "", "only run pending migrations up to and including the given migration")
+	count := flags.Int("count", 0, "only run the next N pending migrations")
+
+	env, err := setup(flags, &cfg, args)
+
+	if err != nil {
+		return err
+	}
+
+	defer env.db.Close()
+
+	countSet := false
+
+	flags.Visit(func(f *flag.Flag) {
+		countSet = countSet || f.Name == "count"
+	})
+
+	if countSet && *to != "" {
+		return errors.New("--to and --count cannot be used together")
+	}
+
+	if countSet && *count < 1 {
+		return fmt.Errorf("--count must be at least 1, got %d", *count)
+	}
+
+	var plan migrate.Plan
+
+	switch {
+	case *to != "":
+		plan, err = migrate.PlanMigrateTo(env.directory, env.log, *to)
+	case *count > 0:
+		plan, err = migrate.PlanMigrateN(env.directory, env.log, *count)
+	default:
+		plan, err = migrate.PlanMigrate(env.directory, env.log)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if !*dryRun {
+		switch {
+		case *to != "":
+			err = migrate.MigrateToContext(env.ctx, env.db, env.directory, env.log, *to)
+		case *count > 0:
+			err = migrate.MigrateNContext(env.ctx, env.db, env.directory, env.log, *count)
+		default:
+			err = migrate.MigrateContext(env.ctx, env.db, env.directory, env.log)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprint(out, plan)
+
+	return nil
+}
+
+func down(args []string, out io.Writer) error {
+	var cfg config
+
+	flags := newFlagSet("down", &cfg, out)
+	dryRun := flags.Bool("dry-run", false, "print the migrations that would be rolled back without executing them")
+	steps := flags.Int("steps", 1, "number of steps to roll back")
+	toStep := flags.Int("to-step", -1, "roll back every step after the given step")
+
+	env, err := setup(flags, &cfg, args)
+
+	if err != nil {
+		return err
+	}
+
+	defer env.db.Close()
+
+	stepsSet, toStepSet := false, false
+
+	flags.Visit(func(f *flag.Flag) {
+		stepsSet = stepsSet || f.Name == "steps"
+		toStepSet = toStepSet || f.Name == "to-step"
+	})
+
+	if stepsSet && toStepSet {
+		return errors.New("--steps and --to-step cannot be used together")
+	}
+
+	var plan migrate.Plan
+
+	if *toStep >= 0 {
+		plan, err = migrate.PlanRollbackTo(env.directory, env.log, *toStep)
+	} else {
+		plan, err = migrate.PlanRollbackSteps(env.directory, env.log, *steps)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if !*dryRun && len(plan.Migrations) > 0 {
+		if *toStep >= 0 {
+			err = migrate.RollbackToContext(env.ctx, env.db, env.directory, env.log, *toStep)
+		} else {
+			err = migrate.RollbackStepsContext(env.ctx, env.db, env.directory, env.log, *steps)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprint(out, plan)
+
+	return nil
+}
+
+func status(args []string, out io.Writer) error {
+	var cfg config
+
+	env, err := setup(newFlagSet("status", &cfg, out), &cfg, args)
+
+	if err != nil {
+		return err
+	}
+
+	defer env.db.Close()
+
+	report, err := migrate.Status(env.directory, env.log)
+
+	if err != nil {
+		return err
+	}
+
+	d, dirty, err := migrate.Dirty(env.log)
+
+	if err != nil {
+		return err
+	}
+
+	if dirty {
+		fmt.Fprintf(out, "dirty: %s, run force-clean once the database has been checked\n", d)
+	}
+
+	for _, s := range report {
+		step := "-"
+
+		if s.Applied() {
+			step = strconv.Itoa(s.Step)
+		}
+
+		fmt.Fprintf(out, "%-12s %-5s %s\n", s.State, step, s.Name)
+	}
+
+	return nil
+}
+
+// Reports applied migrations whose script has changed or been removed
+func verify(args []string, out io.Writer) error {
+	var cfg config
+
+	env, err := setup(newFlagSet("verify", &cfg, out), &cfg, args)
+
+	if err != nil {
+		return err
+	}
+
+	defer env.db.Close()
+
+	drift, err := migrate.Verify(env.directory, env.log)
+
+	if err != nil {
+		return err
+	}
+
+	for _, d := range drift {
+		fmt.Fprintln(out, d)
+	}
+
+	if len(drift) > 0 {
+		return fmt.Errorf("%d applied migrations do not match their scripts", len(drift))
+	}
+
+	fmt.Fprintln(out, "all applied migrations match their scripts")
+
+	return nil
+}
+
+// Rolls back the last step and applies the rolled back migrations again
+func redo(args []string, out io.Writer) error {
+	var cfg config
+
+	env, err := setup(newFlagSet("redo", &cfg, out), &cfg, args)
+
+	if err != nil {
+		return err
+	}
+
+	defer env.db.Close()
+
+	// Also checks every rolled back migration can be applied again
+	redoPlan, err := migrate.PlanRedoContext(env.ctx, env.directory, env.log)
+
+	if errors.Is(err, migrate.ErrNothingToRollback) {
+		return errors.New("no migrations to redo")
+	}
+
+	if err != nil {
+		return err
+	}
+
+	rollbackPlan, err := migrate.PlanRollbackContext(env.ctx, env.directory, env.log)
+
+	if err != nil {
+		return err
+	}
+
+	err = migrate.RedoContext(env.ctx, env.db, env.directory, env.log)
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprint(out, rollbackPlan)
+	fmt.Fprint(out, redoPlan)
+
+	return nil
+}
+
+// Rolls back every step
+func reset(args []string, out io.Writer) error {
+	var cfg config
+
+	env, err := setup(newFlagSet("reset", &cfg, out), &cfg, args)
+
+	if err != nil {
+		return err
+	}
+
+	defer env.db.Close()
+
+	plan, err := migrate.PlanRollbackTo(env.directory, env.log, 0)
+
+	if err != nil {
+		return err
+	}
+
+	err = migrate.ResetContext(env.ctx, env.db, env.directory, env.log)
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprint(out, plan)
+
+	return nil
+}
+
+func create(args []string, out io.Writer) error {
+	var cfg config
+
+	flags := newFlagSet("create", &cfg, out)
+	pair := flags.Bool("pair", false, "create a pair of migrations (up and down)")
+	single := flags.Bool("single", false, "create a single migration with up and down sections")
+
+	err := flags.Parse(args)
+
+	if err != nil {
+		return err
+	}
+
+	if flags.NArg() != 1 {
+		return errors.New("create expects one argument, the name of the migration")
+	}
+
+	if *pair && *single {
+		return errors.New("--pair and --single cannot be used together")
+	}
+
+	if _, err := os.Stat(cfg.dir); os.IsNotExist(err) {
+		err := os.Mkdir(cfg.dir, 0755)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	name := flags.Arg(0)
+	timestamp := strconv.FormatInt(time.Now().UnixNano(), 10)
+
+	if *single {
+		migration, err := migrate.MakeSingleMigration(cfg.dir, name, timestamp)
+
+		if err != nil {
+			return fmt.Errorf("migration %s could not be created: %v", name, err)
+		}
+
+		fmt.Fprintf(out, "migration created: %s\n", migration)
+
+		return nil
+	}
+
+	suffix := ""
+
+	if *pair {
+		suffix = "up"
+	}
+
+	migration, err := migrate.MakeMigration(cfg.dir, name, timestamp, suffix)
+
+	if err != nil {
+		return fmt.Errorf("up migration %s could not be created: %v", name, err)
+	}
+
+	fmt.Fprintf(out, "migration created: %s\n", migration)
+
+	if *pair {
+		migration, err := migrate.MakeMigration(cfg.dir, name, timestamp, "down")
+
+		if err != nil {
+			return fmt.Errorf("down migration %s could not be created: %v", name, err)
+		}
+
+		fmt.Fprintf(out, "migration created: %s\n", migration)
+	}
+
+	return nil
+}
+
+// Converts another tool's migrations and adds those it has applied to the log
+func importMigrations(args []string, out io.Writer) error {
+	var cfg config
+
+	flags := newFlagSet("import", &cfg, out)
+	from := flags.String("from", "", "tool to import from (golang-migrate, goose, dbmate or flyway)")
+	source := flags.String("source", "", "directory containing the tool's migrations")
+	table := flags.String("table", "", "history table of the tool (default: the tool's default table)")
+
+	err := flags.Parse(args)
+
+	if err != nil {
+		return err
+	}
+
+	format, err := importer.ParseFormat(*from)
+
+	if err != nil {
+		return err
+	}
+
+	if *source == "" {
+		return errors.New("--source is required")
+	}
+
+	migrations, err := importer.Convert(format, os.DirFS(*source))
+
+	if err != nil {
+		return err
+	}
+
+	// The log file is stored in the directory by default so it must exist before the log is opened
+	err = os.MkdirAll(cfg.dir, 0755)
+
+	if err != nil {
+		return err
+	}
+
+	db, err := cfg.openDB()
+
+	if err != nil {
+		return err
+	}
+
+	defer db.Close()
+
+	log, err := cfg.openLog(db)
+
+	if err != nil {
+		return err
+	}
+
+	// Read the history before writing anything so a failure leaves the directory untouched
+	applied, err := importer.Applied(context.Background(), format, db, *table, migrations)
+
+	if err != nil {
+		return err
+	}
+
+	// The log can't be seeded while it's dirty, check before the scripts are written
+	d, dirty, err := migrate.Dirty(log)
+
+	if err != nil {
+		return err
+	}
+
+	if dirty {
+		return fmt.Errorf("%w: %s was interrupted, run force-clean once the database has been checked", migrate.ErrDirty, d)
+	}
+
+	created, err := importer.Write(cfg.dir, migrations)
+
+	for _, fileName := range created {
+		fmt.Fprintf(out, "migration created: %s\n", fileName)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	added, err := importer.Seed(log, applied)
+
+	for _, m := range added {
+		fmt.Fprintf(out, "migration logged: %s (step %d)\n", m.Name, m.Step)
+	}
+
+	return err
+}
+
+// Marks the migrations up to the given migration as applied without running them
+func baseline(args []string, out io.Writer) error {
+	var cfg config
+
+	flags := newFlagSet("baseline", &cfg, out)
+	dryRun := flags.Bool("dry-run", false, "print the migrations that would be marked as applied")
+	to := flags.String("to", "", "mark pending migrations up to and including the given migration as applied")
+
+	env, err := setup(flags, &cfg, args)
+
+	if err != nil {
+		return err
+	}
+
+	defer env.db.Close()
+
+	if *to == "" {
+		return errors.New("--to is required")
+	}
+
+	plan, err := migrate.PlanMigrateTo(env.directory, env.log, *to)
+
+	if err != nil {
+		return err
+	}
+
+	if !*dryRun {
+		err = migrate.BaselineContext(env.ctx, env.directory, env.log, *to)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(plan.Migrations) == 0 {
+		fmt.Fprintln(out, "nothing to baseline")
+	}
+
+	for _, m := range plan.Migrations {
+		fmt.Fprintf(out, "migration baselined: %s (step %d)\n", m.Name, m.Step)
+	}
+
+	return nil
+}
+
+// Lists the apply and rollback events recorded in the log history
+func history(args []string, out io.Writer) error {
+	var cfg config
+
+	flags := newFlagSet("history", &cfg, out)
+	name := flags.String("migration", "", "only list the events of the given migration")
+	since := flags.String("since", "", "only list events at or after the given time (RFC 3339)")
+	until := flags.String("until", "", "only list events before the given time (RFC 3339)")
+
+	// The history is only read if the log is opened with it enabled
+	cfg.history = true
+
+	env, err := setup(flags, &cfg, args)
+
+	if err != nil {
+		return err
+	}
+
+	defer env.db.Close()
+
+	filter := migrate.HistoryFilter{Name: *name}
+
+	filter.Since, err = parseTime(*since)
+
+	if err != nil {
+		return err
+	}
+
+	filter.Until, err = parseTime(*until)
+
+	if err != nil {
+		return err
+	}
+
+	events, err := migrate.History(env.log, filter)
+
+	if err != nil {
+		return err
+	}
+
+	for _, e := range events {
+		fmt.Fprintf(out, "%s %-4s %-7s %-5d %s", e.Time.Format(time.RFC3339), e.Direction, e.Outcome, e.Step, e.Name)
+
+		if e.Error != "" {
+			fmt.Fprintf(out, ": %s", e.Error)
+		}
+
+		fmt.Fprintln(out)
+	}
+
+	return nil
+}
+
+// Parses an RFC 3339 time given as a flag, an empty value is the zero time
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time '%s', expected RFC 3339 (e.g. 2024-05-01T12:00:00Z)", value)
+	}
+
+	return t, nil
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/jameswhoughton/migrate"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Options shared by all commands
+type config struct {
+	driver  string
+	dsn     string
+	dir     string
+	log     string
+	logFile string
+	logDSN  string
+	// Encoding of the log file (csv, jsonl or yaml)
+	logFormat string
+	// Schema (or database) and name of the log table
+	logSchema string
+	logTable  string
+	// Time to wait for another process to release the migration lock
+	lockTimeout time.Duration
+	// Identity and label recorded with each applied migration
+	executor string
+	label    string
+	// Record every apply and rollback in the log history
+	history bool
+}
+
+// Returns a flag set for the command with the common flags registered
+func newFlagSet(name string, cfg *config, out io.Writer) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(out)
+
+	flags.StringVar(&cfg.driver, "driver", os.Getenv("MIGRATE_DRIVER"), "database driver (sqlite3, mysql or postgres)")
+	flags.StringVar(&cfg.dsn, "dsn", os.Getenv("MIGRATE_DSN"), "data source name of the database to migrate")
+	flags.StringVar(&cfg.dir, "dir", "migrations", "directory containing the migrations")
+	flags.StringVar(&cfg.log, "log", "file", "log backend (file, sqlite, mysql or postgres)")
+	flags.StringVar(&cfg.logFile, "log-file", "", "path of the log file when using the file log (default: {dir}/.log)")
+	flags.StringVar(&cfg.logFormat, "log-format", "", "encoding of the log file, csv, jsonl or yaml (default: from the file extension or content)")
+	flags.StringVar(&cfg.logDSN, "log-dsn", "", "data source name of the database storing the log (default: --dsn)")
+	flags.StringVar(&cfg.logSchema, "log-schema", "", "schema (or database) in which to store the log table")
+	flags.StringVar(&cfg.logTable, "log-table", "", "name of the log table (default: migrations)")
+	flags.DurationVar(&cfg.lockTimeout, "lock-timeout", migrate.DefaultLockTimeout, "time to wait for the migration lock")
+	flags.StringVar(&cfg.executor, "executor", "", "identity recorded with each applied migration (default: {user}@{host})")
+	flags.StringVar(&cfg.label, "label", "", "free-form label recorded with each applied migration (e.g. the application version)")
+	flags.BoolVar(&cfg.history, "history", false, "record every apply and rollback in the log history")
+
+	return flags
+}
+
+// Opens a connection to the database being migrated
+func (cfg config) openDB() (*sql.DB, error) {
+	if cfg.driver != "sqlite3" && cfg.driver != "mysql" && cfg.driver != "postgres" {
+		return nil, fmt.Errorf("unsupported driver '%s', expected sqlite3, mysql or postgres", cfg.driver)
+	}
+
+	if cfg.dsn == "" {
+		return nil, errors.New("--dsn is required")
+	}
+
+	db, err := sql.Open(cfg.driver, cfg.dsn)
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to open database: %w", err)
+	}
+
+	return db, nil
+}
+
+/*
+Returns the migration log for the selected backend, database logs are stored
+in the migrated database unless --log-dsn is given.
+*/
+func (cfg config) openLog(db *sql.DB) (migrate.MigrationLog, error) {
+	var opts []migrate.LogOption
+
+	if cfg.history {
+		opts = append(opts, migrate.WithHistory())
+	}
+
+	if cfg.log == "file" {
+		path := cfg.logFile
+
+		if path == "" {
+			path = filepath.Join(cfg.dir, ".log")
+		}
+
+		if cfg.logFormat != "" {
+			encoding, ok := map[string]migrate.LogEncoding{"csv": migrate.CSVEncoding{}, "jsonl": migrate.JSONLinesEncoding{}, "yaml": migrate.YAMLEncoding{}}[cfg.logFormat]
+
+			if !ok {
+				return nil, fmt.Errorf("unsupported log format '%s', expected csv, jsonl or yaml", cfg.logFormat)
+			}
+
+			opts = append(opts, migrate.WithEncoding(encoding))
+		}
+
+		log, err := migrate.NewLogFile(path, opts...)
+
+		if err != nil {
+			return nil, err
+		}
+
+		log.LockTimeout = cfg.lockTimeout
+
+		return &log, nil
+	}
+
+	driver := map[string]string{"sqlite": "sqlite3", "mysql": "mysql", "postgres": "postgres"}[cfg.log]
+
+	if driver == "" {
+		return nil, fmt.Errorf("unsupported log '%s', expected file, sqlite, mysql or postgres", cfg.log)
+	}
+
+	opts = append(opts, migrate.WithSchema(cfg.logSchema), migrate.WithTableName(cfg.logTable))
+
+	logDB := db
+
+	if cfg.logDSN != "" || driver != cfg.driver {
+		if cfg.logDSN == "" {
+			return nil, fmt.Errorf("--log-dsn is required when the log is stored in a %s database", cfg.log)
+		}
+
+		var err error
+
+		logDB, err = sql.Open(driver, cfg.logDSN)
+
+		if err != nil {
+			return nil, fmt.Errorf("unable to open log database: %w", err)
+		}
+	}
+
+	switch driver {
+	case "sqlite3":
+		log, err := migrate.NewLogSQLite(logDB, opts...)
+
+		if err != nil {
+			return nil, err
+		}
+
+		log.LockTimeout = cfg.lockTimeout
+
+		return &log, nil
+	case "postgres":
+		log, err := migrate.NewLogPostgres(logDB, opts...)
+
+		if err != nil {
+			return nil, err
+		}
+
+		log.LockTimeout = cfg.lockTimeout
+
+		return &log, nil
+	}
+
+	log, err := migrate.NewLogMySQL(logDB, opts...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	log.LockTimeout = cfg.lockTimeout
+
+	return &log, nil
+}
+
+// Returns the context used to apply migrations, recording the executor and label
+func (cfg config) context() context.Context {
+	ctx := context.Background()
+
+	if cfg.executor != "" {
+		ctx = migrate.WithExecutor(ctx, cfg.executor)
+	}
+
+	if cfg.label != "" {
+		ctx = migrate.WithLabel(ctx, cfg.label)
+	}
+
+	return ctx
+}
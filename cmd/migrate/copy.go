@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/jameswhoughton/migrate"
+)
+
+// Copies the log (selected by the common flags) to another log backend
+func copyLog(args []string, out io.Writer) error {
+	var cfg config
+
+	flags := newFlagSet("copy-log", &cfg, out)
+	toLog := flags.String("to-log", "", "log backend to copy to (file, sqlite, mysql or postgres)")
+	toLogFile := flags.String("to-log-file", "", "path of the destination log file (default: --log-file)")
+	toLogFormat := flags.String("to-log-format", "", "encoding of the destination log file (default: --log-format)")
+	toLogDSN := flags.String("to-log-dsn", "", "data source name of the database storing the destination log (default: --log-dsn)")
+	toLogSchema := flags.String("to-log-schema", "", "schema (or database) of the destination log table (default: --log-schema)")
+	toLogTable := flags.String("to-log-table", "", "name of the destination log table (default: --log-table)")
+	force := flags.Bool("force", false, "replace the migrations in the destination log if it isn't empty")
+	yes := flags.Bool("yes", false, "don't ask for confirmation")
+
+	env, err := setup(flags, &cfg, args)
+
+	if err != nil {
+		return err
+	}
+
+	defer env.db.Close()
+
+	// The destination defaults to the options of the source
+	dst := cfg
+
+	override := func(option *string, value string) {
+		if value != "" {
+			*option = value
+		}
+	}
+
+	override(&dst.log, *toLog)
+	override(&dst.logFile, *toLogFile)
+	override(&dst.logFormat, *toLogFormat)
+	override(&dst.logDSN, *toLogDSN)
+	override(&dst.logSchema, *toLogSchema)
+	override(&dst.logTable, *toLogTable)
+
+	if dst == cfg {
+		return errors.New("the destination is the same log as the source, set --to-log (or another --to-* option)")
+	}
+
+	dstLog, err := dst.openLog(env.db)
+
+	if err != nil {
+		return fmt.Errorf("unable to open destination log: %w", err)
+	}
+
+	if *force {
+		err = confirm(out, *yes, "any migrations in the destination log will be replaced")
+
+		if err != nil {
+			return err
+		}
+
+		err = migrate.ForceCopyLogContext(env.ctx, env.log, dstLog)
+	} else {
+		err = migrate.CopyLogContext(env.ctx, env.log, dstLog)
+	}
+
+	if errors.Is(err, migrate.ErrLogNotEmpty) {
+		return fmt.Errorf("%w, use --force to replace it", err)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	migrations, err := env.log.List()
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "copied %d migrations from the %s log to the %s log\n", len(migrations), cfg.log, dst.log)
+
+	return nil
+}
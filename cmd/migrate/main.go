@@ -0,0 +1,188 @@
+/*
+CLI tool to run migrations compatible with https://github.com/jameswhoughton/migrate
+from shell scripts and CI pipelines.
+
+Usage:
+
+	migrate <command> [flags] [arguments]
+
+The following commands are available:
+
+  - up        run all pending migrations (or --to M, --count N)
+  - down      roll back the most recent step (or --steps N, --to-step S)
+  - status    list every migration and its state
+  - redo      roll back the most recent step and apply it again
+  - reset     roll back every step
+  - create    create a new migration script
+  - verify    report applied migrations whose script has changed
+  - import    convert migrations from golang-migrate, goose, dbmate or Flyway
+  - baseline  mark migrations as applied without running them (--to M)
+  - history   list the apply and rollback events recorded with --history
+  - copy-log  copy the log to another log backend (--to-log L)
+
+The following commands repair the log without running any scripts, each asks for
+confirmation unless `--yes` is given:
+
+  - mark-applied    add a migration to the log (--migration M, --step S)
+  - mark-unapplied  remove a migration from the log (--migration M)
+  - force-step      move a migration to another step (--migration M, --step S)
+  - renumber        renumber the steps so they are sequential
+  - force-clean     clear the dirty state left by an interrupted migration
+  - force-unlock    release the lock left behind by a killed process
+
+The database is selected with the `--driver` (sqlite3, mysql or postgres) and
+`--dsn` options (or the MIGRATE_DRIVER and MIGRATE_DSN environment variables),
+the log backend is selected with `--log` (file, sqlite, mysql or postgres).
+*/
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+)
+
+func showHelp(out io.Writer) {
+	fmt.Fprint(out, `Migrate CLI Tool
+
+Description
+  Tool to run migrations which are compatible with
+  https://github.com/jameswhoughton/migrate
+
+Usage:
+  migrate <command> [flags] [arguments]
+
+Commands:
+  up		Run all pending migrations.
+  down		Roll back the most recent step.
+  status	List every migration and its state.
+  redo		Roll back the most recent step and apply the same
+		migrations again.
+  reset		Roll back every step.
+  create	Create a new migration, accepts a single argument,
+		the name of the migration.
+  verify	Report applied migrations whose script has changed
+		or been removed since it was applied.
+  import	Convert the migrations of another tool (--from) in
+		--source into --dir and add the migrations applied
+		by that tool to the log.
+  baseline	Mark every pending migration up to and including
+		--to as applied without running it.
+  history	List the apply and rollback events recorded in the
+		log history (see --history).
+  copy-log	Copy every migration in the log to the log selected
+		by the --to-* options, e.g. to move from the file log
+		to a database. The destination must be empty unless
+		--force is given.
+  mark-applied	Add --migration to the log in --step (default: a
+		new step) without running it.
+  mark-unapplied	Remove --migration from the log without rolling
+		it back.
+  force-step	Move --migration to --step.
+  renumber	Renumber the steps in the log so they are
+		sequential.
+  force-clean	Clear the dirty state left by a migration which was
+		interrupted, once the database has been checked.
+  force-unlock	Release the lock left behind by a process which was
+		killed while holding it (e.g. the SQLite lock table).
+
+Flags:
+  --driver	Database driver, sqlite3, mysql or postgres
+		(default: $MIGRATE_DRIVER).
+  --dsn		Data source name of the database to migrate
+		(default: $MIGRATE_DSN).
+  --dir		Directory containing the migrations
+		(default: migrations).
+  --log		Log backend, file, sqlite, mysql or postgres
+		(default: file).
+  --log-file	Path of the log file when using the file log
+		(default: {dir}/.log).
+  --log-format	Encoding of the log file, csv, jsonl or yaml
+		(default: from the extension of the file or the
+		content of an existing file).
+  --log-dsn	Data source name of the database storing the log,
+		required if the log uses a different DBMS
+		(default: --dsn).
+  --log-schema	Schema in which to store the log table (the
+		database for mysql, an attached database for sqlite).
+  --log-table	Name of the log table (default: migrations).
+  --lock-timeout	Time to wait for another process to release the
+		migration lock (default: 30s).
+  --executor	Identity recorded with each applied migration
+		(default: {user}@{host}).
+  --label	Free-form label recorded with each applied
+		migration, e.g. the application version.
+  --history	Record every apply and rollback in an append-only
+		history alongside the log.
+  --dry-run	(up, down, baseline) Print the migrations without running them.
+  --to		(up, baseline) Only run (or mark as applied) pending
+		migrations up to and including the given migration
+		name or prefix.
+  --count	(up) Only run the next N pending migrations.
+  --steps	(down) Number of steps to roll back (default: 1).
+  --to-step	(down) Roll back every step after the given step.
+  --pair	(create) Create both a migration and a rollback script.
+  --single	(create) Create a single script with up and down sections.
+  --from	(import) Tool to import from, golang-migrate, goose,
+		dbmate or flyway.
+  --source	(import) Directory containing the tool's migrations.
+  --table	(import) History table of the tool (default: the
+		tool's default table, e.g. goose_db_version).
+  --migration	(mark-applied, mark-unapplied, force-step, history)
+		Name of the migration.
+  --step	(mark-applied, force-step) Step of the migration.
+  --since	(history) Only list events at or after the given
+		time (RFC 3339).
+  --until	(history) Only list events before the given time
+		(RFC 3339).
+  --to-log, --to-log-file, --to-log-format, --to-log-dsn,
+  --to-log-schema, --to-log-table
+		(copy-log) The destination log, each defaults to the
+		matching --log option.
+  --force	(copy-log) Replace the migrations in the destination
+		log if it isn't empty.
+  --yes		(mark-applied, mark-unapplied, force-step, renumber,
+		force-clean, force-unlock, copy-log) Don't ask for
+		confirmation.
+`)
+}
+
+// Runs the command given by the first argument
+func run(args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errors.New("migrate expects a command, see --help")
+	}
+
+	cmd, exists := commands[args[0]]
+
+	if !exists {
+		return fmt.Errorf("unknown command '%s', see --help", args[0])
+	}
+
+	err := cmd(args[1:], out)
+
+	if errors.Is(err, flag.ErrHelp) {
+		return nil
+	}
+
+	return err
+}
+
+func main() {
+	if len(os.Args) > 1 && (os.Args[1] == "--help" || os.Args[1] == "-help" || os.Args[1] == "help") {
+		showHelp(os.Stdout)
+
+		os.Exit(0)
+	}
+
+	err := run(os.Args[1:], os.Stdout)
+
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	os.Exit(0)
+}
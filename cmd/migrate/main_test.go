@@ -0,0 +1,565 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const MIGRATION_DIR = "migrations_test"
+const DB_FILE = "test.db"
+
+// Creates a migration directory containing a pair of migrations
+func setupMigrations(t *testing.T) {
+	t.Helper()
+
+	err := os.Mkdir(MIGRATION_DIR, 0755)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]string{
+		"1_create_users_up.sql":   "CREATE TABLE users (id INT PRIMARY KEY, name VARCHAR(100));",
+		"1_create_users_down.sql": "DROP TABLE users;",
+		"2_create_posts_up.sql":   "CREATE TABLE posts (id INT PRIMARY KEY, title VARCHAR(100));",
+		"2_create_posts_down.sql": "DROP TABLE posts;",
+	}
+
+	for name, query := range files {
+		err := os.WriteFile(filepath.Join(MIGRATION_DIR, name), []byte(query), 0644)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func runCommand(t *testing.T, args ...string) string {
+	t.Helper()
+
+	var out bytes.Buffer
+
+	args = append(args, "--driver=sqlite3", "--dsn="+DB_FILE, "--dir="+MIGRATION_DIR)
+
+	err := run(args, &out)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return out.String()
+}
+
+// up rejects a count below 1 and --to combined with --count
+func TestUpRejectsInvalidCount(t *testing.T) {
+	defer os.RemoveAll(MIGRATION_DIR)
+	defer os.Remove(DB_FILE)
+
+	setupMigrations(t)
+
+	for _, args := range [][]string{{"--count=0"}, {"--count=-1"}, {"--to=1_create_users", "--count=1"}} {
+		var buf bytes.Buffer
+
+		err := run(append([]string{"up", "--driver=sqlite3", "--dsn=" + DB_FILE, "--dir=" + MIGRATION_DIR}, args...), &buf)
+
+		if err == nil {
+			t.Fatalf("Expected error for %v, got nil", args)
+		}
+	}
+
+	out := runCommand(t, "status")
+
+	if strings.Contains(out, "applied") {
+		t.Fatalf("Expected no migrations to be applied, got %s", out)
+	}
+}
+
+// status lists each migration with its state and step
+func TestStatusListsMigrations(t *testing.T) {
+	defer os.RemoveAll(MIGRATION_DIR)
+	defer os.Remove(DB_FILE)
+
+	setupMigrations(t)
+
+	runCommand(t, "up", "--count=1")
+
+	out := runCommand(t, "status")
+	expected := "applied      1     1_create_users\npending      -     2_create_posts\n"
+
+	if out != expected {
+		t.Fatalf("Expected %q, got %q", expected, out)
+	}
+}
+
+// redo rolls back the last step and applies only its migrations again
+func TestRedoReappliesLastStep(t *testing.T) {
+	defer os.RemoveAll(MIGRATION_DIR)
+	defer os.Remove(DB_FILE)
+
+	setupMigrations(t)
+
+	runCommand(t, "up", "--to=2_create_posts")
+
+	// Sorts before the rolled back migration but must not be applied by redo
+	err := os.WriteFile(filepath.Join(MIGRATION_DIR, "1_5_create_tags_up.sql"), []byte("CREATE TABLE tags (id INT);"), 0644)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := runCommand(t, "redo")
+
+	if !strings.Contains(out, "down\tstep 1\t2_create_posts") || !strings.Contains(out, "up\tstep 1\t2_create_posts") {
+		t.Fatalf("Expected 2_create_posts to be rolled back and applied again, got %s", out)
+	}
+
+	out = runCommand(t, "status")
+
+	if !strings.Contains(out, "pending      -     1_5_create_tags") {
+		t.Fatalf("Expected 1_5_create_tags to remain pending, got %s", out)
+	}
+
+	// A rolled back migration without a script can't be applied again, nothing is rolled back
+	os.Remove(filepath.Join(MIGRATION_DIR, "2_create_posts_up.sql"))
+
+	var buf bytes.Buffer
+
+	err = run([]string{"redo", "--driver=sqlite3", "--dsn=" + DB_FILE, "--dir=" + MIGRATION_DIR}, &buf)
+
+	if err == nil {
+		t.Fatal("Expected error, got nil")
+	}
+
+	out = runCommand(t, "status")
+
+	if !strings.Contains(out, "2_create_posts") || strings.Contains(out, "pending      -     2_create_posts") {
+		t.Fatalf("Expected 2_create_posts to remain applied, got %s", out)
+	}
+}
+
+// down rejects --steps combined with --to-step
+func TestDownRejectsStepsWithToStep(t *testing.T) {
+	defer os.RemoveAll(MIGRATION_DIR)
+	defer os.Remove(DB_FILE)
+
+	setupMigrations(t)
+
+	runCommand(t, "up")
+
+	var buf bytes.Buffer
+
+	err := run([]string{"down", "--steps=1", "--to-step=0", "--driver=sqlite3", "--dsn=" + DB_FILE, "--dir=" + MIGRATION_DIR}, &buf)
+
+	if err == nil {
+		t.Fatal("Expected error, got nil")
+	}
+
+	out := runCommand(t, "status")
+
+	if strings.Contains(out, "pending") {
+		t.Fatalf("Expected no migrations to be rolled back, got %s", out)
+	}
+}
+
+// up runs pending migrations and down rolls them back
+func TestUpAndDownRunMigrations(t *testing.T) {
+	defer os.RemoveAll(MIGRATION_DIR)
+	defer os.Remove(DB_FILE)
+
+	setupMigrations(t)
+
+	out := runCommand(t, "up")
+
+	if !strings.Contains(out, "1_create_users") || !strings.Contains(out, "2_create_posts") {
+		t.Fatalf("Expected both migrations to run, got %s", out)
+	}
+
+	out = runCommand(t, "status")
+
+	if strings.Count(out, "applied") != 2 {
+		t.Fatalf("Expected 2 applied migrations, got %s", out)
+	}
+
+	runCommand(t, "down")
+
+	out = runCommand(t, "status")
+
+	if strings.Count(out, "pending") != 2 {
+		t.Fatalf("Expected 2 pending migrations, got %s", out)
+	}
+}
+
+// up --dry-run doesn't run any migrations
+func TestUpDryRunDoesNotMigrate(t *testing.T) {
+	defer os.RemoveAll(MIGRATION_DIR)
+	defer os.Remove(DB_FILE)
+
+	setupMigrations(t)
+
+	runCommand(t, "up", "--dry-run")
+
+	out := runCommand(t, "status")
+
+	if strings.Count(out, "pending") != 2 {
+		t.Fatalf("Expected 2 pending migrations, got %s", out)
+	}
+}
+
+// reset rolls back every step
+func TestResetRollsBackEveryStep(t *testing.T) {
+	defer os.RemoveAll(MIGRATION_DIR)
+	defer os.Remove(DB_FILE)
+
+	setupMigrations(t)
+
+	os.Rename(filepath.Join(MIGRATION_DIR, "2_create_posts_up.sql"), "2_create_posts_up.sql")
+	runCommand(t, "up", "--log=sqlite")
+	os.Rename("2_create_posts_up.sql", filepath.Join(MIGRATION_DIR, "2_create_posts_up.sql"))
+	runCommand(t, "up", "--log=sqlite")
+
+	runCommand(t, "reset", "--log=sqlite")
+
+	out := runCommand(t, "status", "--log=sqlite")
+
+	if strings.Count(out, "pending") != 2 {
+		t.Fatalf("Expected 2 pending migrations, got %s", out)
+	}
+}
+
+// unknown commands return an error
+func TestUnknownCommandReturnsError(t *testing.T) {
+	var out bytes.Buffer
+
+	err := run([]string{"sideways"}, &out)
+
+	if err == nil {
+		t.Fatal("Expected error, got nil")
+	}
+}
+
+// down --steps rolls back multiple steps
+func TestDownStepsRollsBackMultipleSteps(t *testing.T) {
+	defer os.RemoveAll(MIGRATION_DIR)
+	defer os.Remove(DB_FILE)
+
+	setupMigrations(t)
+
+	os.Rename(filepath.Join(MIGRATION_DIR, "2_create_posts_up.sql"), "2_create_posts_up.sql")
+	runCommand(t, "up")
+	os.Rename("2_create_posts_up.sql", filepath.Join(MIGRATION_DIR, "2_create_posts_up.sql"))
+	runCommand(t, "up")
+
+	out := runCommand(t, "down", "--steps=2")
+
+	if !strings.Contains(out, "1_create_users") || !strings.Contains(out, "2_create_posts") {
+		t.Fatalf("Expected both migrations to be rolled back, got %s", out)
+	}
+
+	out = runCommand(t, "status")
+
+	if strings.Count(out, "pending") != 2 {
+		t.Fatalf("Expected 2 pending migrations, got %s", out)
+	}
+}
+
+// import converts goose migrations and logs those goose has applied
+func TestImportConvertsMigrationsAndSeedsLog(t *testing.T) {
+	const sourceDir = "goose_test"
+
+	defer os.RemoveAll(MIGRATION_DIR)
+	defer os.RemoveAll(sourceDir)
+	defer os.Remove(DB_FILE)
+
+	os.Mkdir(sourceDir, 0755)
+	os.WriteFile(filepath.Join(sourceDir, "1_create_users.sql"), []byte("-- +goose Up\nCREATE TABLE users (id INT);\n-- +goose Down\nDROP TABLE users;\n"), 0644)
+	os.WriteFile(filepath.Join(sourceDir, "2_create_posts.sql"), []byte("-- +goose Up\nCREATE TABLE posts (id INT);\n"), 0644)
+
+	db, _ := sql.Open("sqlite3", DB_FILE)
+	db.Exec("CREATE TABLE goose_db_version (id INTEGER PRIMARY KEY AUTOINCREMENT, version_id INTEGER, is_applied INTEGER)")
+	db.Exec("INSERT INTO goose_db_version (version_id, is_applied) VALUES (0, 1), (1, 1)")
+	db.Exec("CREATE TABLE users (id INT)")
+	db.Close()
+
+	out := runCommand(t, "import", "--from=goose", "--source="+sourceDir)
+
+	if strings.Count(out, "migration created") != 3 || strings.Count(out, "migration logged") != 1 {
+		t.Fatalf("Expected 3 scripts to be created and 1 migration to be logged, got %s", out)
+	}
+
+	out = runCommand(t, "up")
+
+	if strings.Contains(out, "create_users") || !strings.Contains(out, "create_posts") {
+		t.Fatalf("Expected only create_posts to run, got %s", out)
+	}
+}
+
+// baseline marks migrations as applied without running them
+func TestBaselineMarksMigrationsAsApplied(t *testing.T) {
+	defer os.RemoveAll(MIGRATION_DIR)
+	defer os.Remove(DB_FILE)
+
+	setupMigrations(t)
+
+	out := runCommand(t, "baseline", "--to=1")
+
+	if !strings.Contains(out, "1_create_users") || strings.Contains(out, "2_create_posts") {
+		t.Fatalf("Expected only 1_create_users to be baselined, got %s", out)
+	}
+
+	out = runCommand(t, "up")
+
+	if strings.Contains(out, "1_create_users") || !strings.Contains(out, "2_create_posts") {
+		t.Fatalf("Expected only 2_create_posts to run, got %s", out)
+	}
+}
+
+// mark-unapplied asks for confirmation before modifying the log
+func TestMarkUnappliedRequiresConfirmation(t *testing.T) {
+	defer os.RemoveAll(MIGRATION_DIR)
+	defer os.Remove(DB_FILE)
+	defer func() { stdin = os.Stdin }()
+
+	setupMigrations(t)
+	runCommand(t, "up")
+
+	var buf bytes.Buffer
+
+	stdin = strings.NewReader("n\n")
+
+	err := run([]string{"mark-unapplied", "--migration=1_create_users", "--driver=sqlite3", "--dsn=" + DB_FILE, "--dir=" + MIGRATION_DIR}, &buf)
+
+	if err == nil {
+		t.Fatal("Expected error when the prompt is declined, got nil")
+	}
+
+	stdin = strings.NewReader("y\n")
+
+	runCommand(t, "mark-unapplied", "--migration=1_create_users")
+
+	out := runCommand(t, "status")
+
+	if !strings.Contains(out, "pending      -     1_create_users") {
+		t.Fatalf("Expected 1_create_users to be pending, got %s", out)
+	}
+
+	runCommand(t, "mark-applied", "--migration=1_create_users", "--step=1", "--yes")
+
+	out = runCommand(t, "status")
+
+	if strings.Count(out, "applied") != 2 {
+		t.Fatalf("Expected 2 applied migrations, got %s", out)
+	}
+}
+
+// status reports a dirty log and force-clean clears it
+func TestForceCleanClearsDirtyLog(t *testing.T) {
+	defer os.RemoveAll(MIGRATION_DIR)
+	defer os.Remove(DB_FILE)
+
+	setupMigrations(t)
+
+	err := os.WriteFile(filepath.Join(MIGRATION_DIR, "3_broken_up.sql"), []byte("-- migrate:no-transaction\nI am not a valid query;"), 0644)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+
+	err = run([]string{"up", "--driver=sqlite3", "--dsn=" + DB_FILE, "--dir=" + MIGRATION_DIR}, &buf)
+
+	if err == nil {
+		t.Fatal("Expected error, got nil")
+	}
+
+	out := runCommand(t, "status")
+
+	if !strings.Contains(out, "dirty: 3_broken (up, step 1)") {
+		t.Fatalf("Expected status to report the dirty migration, got %s", out)
+	}
+
+	out = runCommand(t, "force-clean", "--yes")
+
+	if !strings.Contains(out, "log marked as clean: 3_broken") {
+		t.Fatalf("Expected force-clean to report the migration, got %s", out)
+	}
+
+	out = runCommand(t, "status")
+
+	if strings.Contains(out, "dirty") {
+		t.Fatalf("Expected log to be clean, got %s", out)
+	}
+}
+
+// up and down record events in the history when --history is given, which history lists
+func TestHistoryListsEvents(t *testing.T) {
+	defer os.RemoveAll(MIGRATION_DIR)
+	defer os.Remove(DB_FILE)
+
+	setupMigrations(t)
+
+	runCommand(t, "up", "--history")
+	runCommand(t, "down", "--history")
+
+	out := runCommand(t, "history", "--migration=1_create_users")
+
+	if strings.Count(out, "1_create_users") != 2 || !strings.Contains(out, "up   success") || !strings.Contains(out, "down success") {
+		t.Fatalf("Expected an up and a down event for 1_create_users, got %s", out)
+	}
+
+	out = runCommand(t, "history", "--until=2000-01-01T00:00:00Z")
+
+	if out != "" {
+		t.Fatalf("Expected no events before 2000, got %s", out)
+	}
+}
+
+// force-unlock releases the SQLite lock left behind by a killed process
+func TestForceUnlockReleasesStaleLock(t *testing.T) {
+	defer os.RemoveAll(MIGRATION_DIR)
+	defer os.Remove(DB_FILE)
+
+	setupMigrations(t)
+
+	db, err := sql.Open("sqlite3", DB_FILE)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	_, err = db.Exec("CREATE TABLE migrations_lock (id INTEGER PRIMARY KEY CHECK (id = 1), locked_at TEXT NOT NULL); INSERT INTO migrations_lock VALUES (1, '2024-01-01T00:00:00Z');")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := runCommand(t, "force-unlock", "--log=sqlite", "--yes")
+
+	if !strings.Contains(out, "migration lock released") {
+		t.Fatalf("Expected the lock to be released, got %s", out)
+	}
+
+	runCommand(t, "up", "--log=sqlite", "--lock-timeout=200ms")
+}
+
+// down records the executor and label in the history
+func TestDownHistoryRecordsExecutor(t *testing.T) {
+	defer os.RemoveAll(MIGRATION_DIR)
+	defer os.Remove(DB_FILE)
+
+	setupMigrations(t)
+
+	runCommand(t, "up", "--log=sqlite", "--history")
+	runCommand(t, "down", "--log=sqlite", "--history", "--executor=ci", "--label=release-1")
+
+	db, err := sql.Open("sqlite3", DB_FILE)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	var executor, label string
+
+	err = db.QueryRow("SELECT executor, label FROM migrations_history WHERE direction = 'down'").Scan(&executor, &label)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if executor != "ci" || label != "release-1" {
+		t.Fatalf("Expected executor 'ci' and label 'release-1', got '%s' and '%s'", executor, label)
+	}
+}
+
+// --log-table stores the log in the given table
+func TestLogTableOption(t *testing.T) {
+	defer os.RemoveAll(MIGRATION_DIR)
+	defer os.Remove(DB_FILE)
+
+	setupMigrations(t)
+
+	runCommand(t, "up", "--log=sqlite", "--log-table=app_migrations")
+
+	db, err := sql.Open("sqlite3", DB_FILE)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	var count int
+
+	db.QueryRow("SELECT COUNT(*) FROM app_migrations").Scan(&count)
+
+	if count != 2 {
+		t.Fatalf("Expected 2 migrations in app_migrations, got %d", count)
+	}
+}
+
+// --log-format selects the encoding of the file log
+func TestLogFormatOption(t *testing.T) {
+	defer os.RemoveAll(MIGRATION_DIR)
+	defer os.Remove(DB_FILE)
+
+	setupMigrations(t)
+
+	runCommand(t, "up", "--log-format=jsonl")
+
+	content, err := os.ReadFile(filepath.Join(MIGRATION_DIR, ".log"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(string(content), `{"name":"1_create_users","step":1`) {
+		t.Fatalf("Expected a JSON Lines log, got:\n%s", content)
+	}
+
+	// The encoding is detected when the log is loaded again
+	out := runCommand(t, "status")
+
+	if !strings.Contains(out, "2_create_posts") {
+		t.Fatalf("Expected status to list the applied migrations, got:\n%s", out)
+	}
+}
+
+// copy-log copies the file log into the database, refusing to overwrite it without --force
+func TestCopyLogCopiesToAnotherBackend(t *testing.T) {
+	defer os.RemoveAll(MIGRATION_DIR)
+	defer os.Remove(DB_FILE)
+
+	setupMigrations(t)
+
+	runCommand(t, "up")
+
+	out := runCommand(t, "copy-log", "--to-log=sqlite")
+
+	if !strings.Contains(out, "copied 2 migrations from the file log to the sqlite log") {
+		t.Fatalf("Unexpected output:\n%s", out)
+	}
+
+	out = runCommand(t, "status", "--log=sqlite")
+
+	if !strings.Contains(out, "2_create_posts") {
+		t.Fatalf("Expected the sqlite log to contain the migrations, got:\n%s", out)
+	}
+
+	var buf bytes.Buffer
+
+	err := run([]string{"copy-log", "--to-log=sqlite", "--driver=sqlite3", "--dsn=" + DB_FILE, "--dir=" + MIGRATION_DIR}, &buf)
+
+	if err == nil || !strings.Contains(err.Error(), "--force") {
+		t.Fatalf("Expected copying into a non-empty log to fail, got %v", err)
+	}
+
+	runCommand(t, "copy-log", "--to-log=sqlite", "--force", "--yes")
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/jameswhoughton/migrate"
+)
+
+// Input used to answer confirmation prompts
+var stdin io.Reader = os.Stdin
+
+// Asks for confirmation before modifying the log, skipped if --yes is given
+func confirm(out io.Writer, yes bool, action string) error {
+	if yes {
+		return nil
+	}
+
+	fmt.Fprintf(out, "%s, continue? [y/N] ", action)
+
+	answer, _ := bufio.NewReader(stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+
+	if answer != "y" && answer != "yes" {
+		return errors.New("aborted, the log has not been modified")
+	}
+
+	return nil
+}
+
+// Adds a migration to the log without running it
+func markApplied(args []string, out io.Writer) error {
+	var cfg config
+
+	flags := newFlagSet("mark-applied", &cfg, out)
+	name := flags.String("migration", "", "name of the migration to mark as applied")
+	step := flags.Int("step", 0, "step in which to add the migration (default: a new step)")
+	yes := flags.Bool("yes", false, "don't ask for confirmation")
+
+	env, err := setup(flags, &cfg, args)
+
+	if err != nil {
+		return err
+	}
+
+	defer env.db.Close()
+
+	if *name == "" {
+		return errors.New("--migration is required")
+	}
+
+	target := "a new step"
+
+	if *step != 0 {
+		target = fmt.Sprintf("step %d", *step)
+	}
+
+	err = confirm(out, *yes, fmt.Sprintf("%s will be marked as applied in %s without running it", *name, target))
+
+	if err != nil {
+		return err
+	}
+
+	err = migrate.MarkAppliedContext(env.ctx, env.directory, env.log, *name, *step)
+
+	if err != nil {
+		return err
+	}
+
+	// The new step is chosen once the log is locked, it's the most recent step
+	if *step == 0 {
+		*step = env.log.LastStep()
+	}
+
+	fmt.Fprintf(out, "migration marked as applied: %s (step %d)\n", *name, *step)
+
+	return nil
+}
+
+// Removes a migration from the log without rolling it back
+func markUnapplied(args []string, out io.Writer) error {
+	var cfg config
+
+	flags := newFlagSet("mark-unapplied", &cfg, out)
+	name := flags.String("migration", "", "name of the migration to remove from the log")
+	yes := flags.Bool("yes", false, "don't ask for confirmation")
+
+	env, err := setup(flags, &cfg, args)
+
+	if err != nil {
+		return err
+	}
+
+	defer env.db.Close()
+
+	if *name == "" {
+		return errors.New("--migration is required")
+	}
+
+	err = confirm(out, *yes, fmt.Sprintf("%s will be removed from the log without rolling it back", *name))
+
+	if err != nil {
+		return err
+	}
+
+	err = migrate.MarkUnapplied(env.log, *name)
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "migration marked as unapplied: %s\n", *name)
+
+	return nil
+}
+
+// Moves a migration to another step
+func forceStep(args []string, out io.Writer) error {
+	var cfg config
+
+	flags := newFlagSet("force-step", &cfg, out)
+	name := flags.String("migration", "", "name of the migration to move")
+	step := flags.Int("step", 0, "step to move the migration to")
+	yes := flags.Bool("yes", false, "don't ask for confirmation")
+
+	env, err := setup(flags, &cfg, args)
+
+	if err != nil {
+		return err
+	}
+
+	defer env.db.Close()
+
+	if *name == "" || *step < 1 {
+		return errors.New("--migration and --step are required")
+	}
+
+	err = confirm(out, *yes, fmt.Sprintf("%s will be moved to step %d", *name, *step))
+
+	if err != nil {
+		return err
+	}
+
+	err = migrate.ForceStep(env.log, *name, *step)
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "migration moved: %s (step %d)\n", *name, *step)
+
+	return nil
+}
+
+// Renumbers the steps in the log so they are sequential
+func renumber(args []string, out io.Writer) error {
+	var cfg config
+
+	flags := newFlagSet("renumber", &cfg, out)
+	yes := flags.Bool("yes", false, "don't ask for confirmation")
+
+	env, err := setup(flags, &cfg, args)
+
+	if err != nil {
+		return err
+	}
+
+	defer env.db.Close()
+
+	err = confirm(out, *yes, "the steps in the log will be renumbered")
+
+	if err != nil {
+		return err
+	}
+
+	err = migrate.RenumberSteps(env.log)
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(out, "steps renumbered")
+
+	return nil
+}
+
+// Clears the dirty state left by an interrupted migration
+func forceClean(args []string, out io.Writer) error {
+	var cfg config
+
+	flags := newFlagSet("force-clean", &cfg, out)
+	yes := flags.Bool("yes", false, "don't ask for confirmation")
+
+	env, err := setup(flags, &cfg, args)
+
+	if err != nil {
+		return err
+	}
+
+	defer env.db.Close()
+
+	d, dirty, err := migrate.Dirty(env.log)
+
+	if err == nil && !dirty {
+		fmt.Fprintln(out, "the log is not dirty")
+
+		return nil
+	}
+
+	action := fmt.Sprintf("%s will be marked as clean, check the database first", d)
+
+	// The dirty state can't be read, it's cleared without knowing which migration was interrupted
+	if err != nil {
+		action = fmt.Sprintf("%v, the dirty state will be cleared, check the database first", err)
+	}
+
+	err = confirm(out, *yes, action)
+
+	if err != nil {
+		return err
+	}
+
+	d, err = migrate.ForceClean(env.log)
+
+	if err != nil {
+		return err
+	}
+
+	if d.Name == "" {
+		fmt.Fprintln(out, "log marked as clean")
+
+		return nil
+	}
+
+	fmt.Fprintf(out, "log marked as clean: %s\n", d)
+
+	return nil
+}
+
+// Releases a lock left behind by a process which was killed while holding it
+func forceUnlock(args []string, out io.Writer) error {
+	var cfg config
+
+	flags := newFlagSet("force-unlock", &cfg, out)
+	yes := flags.Bool("yes", false, "don't ask for confirmation")
+
+	env, err := setup(flags, &cfg, args)
+
+	if err != nil {
+		return err
+	}
+
+	defer env.db.Close()
+
+	err = confirm(out, *yes, "the migration lock will be released, check no other process is running migrations first")
+
+	if err != nil {
+		return err
+	}
+
+	err = migrate.ForceUnlockContext(env.ctx, env.log)
+
+	if errors.Is(err, migrate.ErrForceUnlockUnsupported) {
+		fmt.Fprintf(out, "the %s log doesn't need to be unlocked, %s\n", cfg.log, err)
+
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(out, "migration lock released")
+
+	return nil
+}
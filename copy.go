@@ -0,0 +1,112 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Returned by CopyLog if the destination log already contains migrations
+var ErrLogNotEmpty = errors.New("destination log is not empty")
+
+/*
+CopyLog copies every migration in src to dst in the same order and with the same
+steps, checksums and metadata, for example to move from LogFile to LogMySQL.
+Once copied the destination is read back and compared with the source, an error
+is returned if they differ.
+
+The destination must be empty (ErrLogNotEmpty is returned otherwise, see
+ForceCopyLog) and the source must not be dirty. Only the log is copied, the
+dirty state and history of the source are not. If either log implements Locker
+the lock is held for the duration of the call.
+*/
+func CopyLog(src, dst MigrationLog) error {
+	return CopyLogContext(context.Background(), src, dst)
+}
+
+// CopyLogContext is the same as CopyLog but accepts a context.
+func CopyLogContext(ctx context.Context, src, dst MigrationLog) error {
+	return copyLog(ctx, src, dst, false)
+}
+
+/*
+ForceCopyLog is the same as CopyLog but removes any migrations already in the
+destination before copying.
+*/
+func ForceCopyLog(src, dst MigrationLog) error {
+	return ForceCopyLogContext(context.Background(), src, dst)
+}
+
+// ForceCopyLogContext is the same as ForceCopyLog but accepts a context.
+func ForceCopyLogContext(ctx context.Context, src, dst MigrationLog) error {
+	return copyLog(ctx, src, dst, true)
+}
+
+func copyLog(ctx context.Context, src, dst MigrationLog, force bool) error {
+	return withLock(ctx, src, func() error {
+		return withLock(ctx, dst, func() error {
+			if err := checkClean(ctx, src); err != nil {
+				return fmt.Errorf("CopyLog: %w", err)
+			}
+
+			migrations, err := logList(ctx, src)
+
+			if err != nil {
+				return fmt.Errorf("CopyLog: unable to list source migrations: %w", err)
+			}
+
+			existing, err := logList(ctx, dst)
+
+			if err != nil {
+				return fmt.Errorf("CopyLog: unable to list destination migrations: %w", err)
+			}
+
+			if len(existing) > 0 && !force {
+				return fmt.Errorf("CopyLog: %w: it contains %d migrations", ErrLogNotEmpty, len(existing))
+			}
+
+			for range existing {
+				if _, err := logPop(ctx, dst); err != nil {
+					return fmt.Errorf("CopyLog: unable to pop migration from destination: %w", err)
+				}
+			}
+
+			for _, m := range migrations {
+				if err := logAdd(ctx, dst, m); err != nil {
+					return fmt.Errorf("CopyLog: unable to add migration '%s' to destination: %w", m.Name, err)
+				}
+			}
+
+			copied, err := logList(ctx, dst)
+
+			if err != nil {
+				return fmt.Errorf("CopyLog: unable to list destination migrations: %w", err)
+			}
+
+			if err := compareLogs(migrations, copied); err != nil {
+				return fmt.Errorf("CopyLog: destination differs from source: %w", err)
+			}
+
+			return nil
+		})
+	})
+}
+
+// Returns an error describing the first difference between the migrations
+func compareLogs(expected, actual []Migration) error {
+	if len(expected) != len(actual) {
+		return fmt.Errorf("expected %d migrations, got %d", len(expected), len(actual))
+	}
+
+	for i := range expected {
+		e, a := expected[i], actual[i]
+
+		// AppliedAt is compared with Equal as the location may differ between logs
+		if e.Name != a.Name || e.Step != a.Step || e.Checksum != a.Checksum || !e.AppliedAt.Equal(a.AppliedAt) ||
+			e.Duration != a.Duration || e.Executor != a.Executor || e.Label != a.Label {
+			return fmt.Errorf("entry %d is %+v, expected %+v", i+1, a, e)
+		}
+	}
+
+	return nil
+}
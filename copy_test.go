@@ -0,0 +1,147 @@
+package migrate_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jameswhoughton/migrate"
+)
+
+// Migrations with the metadata recorded by Migrate
+var copyMigrations = []migrate.Migration{
+	{Name: "1_create_users", Step: 1, Checksum: "abc", AppliedAt: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), Duration: 12 * time.Millisecond, Executor: "ci@runner", Label: "v1"},
+	{Name: "2_create_posts", Step: 1, Checksum: "def"},
+	{Name: "3_add_index", Step: 2},
+}
+
+// CopyLog() copies a file log into a database log, preserving order, steps and metadata
+func TestCopyLogFromFileToSQLite(t *testing.T) {
+	defer os.RemoveAll(LOG_DIR)
+	defer os.Remove("test.db")
+
+	src, err := migrate.NewLogFile(LOG_DIR + string(os.PathSeparator) + LOG_FILE)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, m := range copyMigrations {
+		if err := src.Add(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	db, _ := sql.Open("sqlite3", "test.db")
+
+	dst, err := migrate.NewLogSQLite(db)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = migrate.CopyLog(&src, &dst)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	copied, err := dst.List()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(copied) != len(copyMigrations) {
+		t.Fatalf("Expected %d migrations, got %d", len(copyMigrations), len(copied))
+	}
+
+	for i, m := range copyMigrations {
+		if copied[i] != m {
+			t.Errorf("Expected %v, got %v", m, copied[i])
+		}
+	}
+}
+
+// CopyLog() refuses to copy into a log which isn't empty, ForceCopyLog() replaces it
+func TestCopyLogRefusesNonEmptyDestination(t *testing.T) {
+	src := newTestLog()
+	dst := newTestLog()
+
+	for _, m := range copyMigrations {
+		src.Add(m)
+	}
+
+	dst.Add(migrate.Migration{Name: "0_existing", Step: 1})
+
+	err := migrate.CopyLog(&src, &dst)
+
+	if !errors.Is(err, migrate.ErrLogNotEmpty) {
+		t.Fatalf("Expected ErrLogNotEmpty, got %v", err)
+	}
+
+	if len(dst.store) != 1 {
+		t.Fatalf("Expected the destination to be unchanged, got %v", dst.store)
+	}
+
+	err = migrate.ForceCopyLog(&src, &dst)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(dst.store) != len(copyMigrations) || dst.store[0].Name != "1_create_users" {
+		t.Fatalf("Expected the destination to be replaced, got %v", dst.store)
+	}
+}
+
+// CopyLog() refuses to copy a dirty log
+func TestCopyLogRefusesDirtySource(t *testing.T) {
+	defer os.RemoveAll(LOG_DIR)
+
+	src, err := migrate.NewLogFile(LOG_DIR + string(os.PathSeparator) + LOG_FILE)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	src.SetDirty(context.Background(), migrate.DirtyMigration{Name: "1_create_users", Direction: migrate.DirectionUp, Step: 1, StartedAt: time.Now()})
+
+	dst := newTestLog()
+
+	err = migrate.CopyLog(&src, &dst)
+
+	if !errors.Is(err, migrate.ErrDirty) {
+		t.Fatalf("Expected ErrDirty, got %v", err)
+	}
+}
+
+// A log which doesn't store the label
+type lossyLog struct {
+	testLog
+}
+
+func (ml *lossyLog) Add(m migrate.Migration) error {
+	m.Label = ""
+
+	return ml.testLog.Add(m)
+}
+
+// CopyLog() returns an error if the destination doesn't match the source once copied
+func TestCopyLogVerifiesDestination(t *testing.T) {
+	src := newTestLog()
+	dst := lossyLog{}
+
+	for _, m := range copyMigrations {
+		src.Add(m)
+	}
+
+	err := migrate.CopyLog(&src, &dst)
+
+	if err == nil {
+		t.Fatal("Expected an error, got nil")
+	}
+}
@@ -24,6 +24,21 @@ The suffix can be blank or 'up' (if creating migrations) but when creating rollb
 the suffix should always be 'down'.
 */
 func MakeMigration(directory, name, prefix, suffix string) (string, error) {
+	return makeMigration(directory, name, prefix, suffix, "")
+}
+
+/*
+MakeSingleMigration creates a new script file containing empty up and down
+sections (see UpDirective), allowing the migration and its rollback to be kept
+in the same file.
+
+The name and prefix are handled in the same way as MakeMigration.
+*/
+func MakeSingleMigration(directory, name, prefix string) (string, error) {
+	return makeMigration(directory, name, prefix, "", UpDirective+"\n\n"+DownDirective+"\n")
+}
+
+func makeMigration(directory, name, prefix, suffix, content string) (string, error) {
 	// Normalise names
 	illegalCharacterRegexp := regexp.MustCompile(`[^a-zA-Z\d]+`)
 
@@ -43,7 +58,7 @@ func MakeMigration(directory, name, prefix, suffix string) (string, error) {
 
 	migrationName += ".sql"
 
-	err := os.WriteFile(directory+string(os.PathSeparator)+migrationName, []byte(""), 0644)
+	err := os.WriteFile(directory+string(os.PathSeparator)+migrationName, []byte(content), 0644)
 
 	if err != nil {
 		return "", fmt.Errorf("MakeMigration: unable to write file %s to directory %s: %v", migrationName, directory, err)
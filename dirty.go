@@ -0,0 +1,174 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Returned by Migrate and Rollback (and their variants) when the log is dirty
+var ErrDirty = errors.New("log is dirty")
+
+/*
+A migration (or rollback) which was started but didn't complete, for example
+because the process was killed while the script was running. StartedAt is in UTC.
+*/
+type DirtyMigration struct {
+	Name      string
+	Direction Direction
+	Step      int
+	StartedAt time.Time
+}
+
+func (d DirtyMigration) String() string {
+	return fmt.Sprintf("%s (%s, step %d) started at %s", d.Name, d.Direction, d.Step, d.StartedAt.Format(time.RFC3339))
+}
+
+/*
+Optional extension of MigrationLog which records the migration in flight.
+
+If the log implements MigrationLogDirty, Migrate and Rollback call SetDirty
+before executing each script and ClearDirty once the script has completed and
+the log has been updated. If the process dies in between, the log remains dirty
+and Migrate/Rollback refuse to run (returning ErrDirty) until the database has
+been checked and ForceClean has been called.
+
+A script which fails inside a transaction is rolled back so the log is cleared,
+a script which fails outside of a transaction (see NoTransactionDirective) may
+have been partially applied so the log is left dirty.
+
+Dirty should return false if no migration is in flight. All of the log drivers
+in the package implement MigrationLogDirty.
+*/
+type MigrationLogDirty interface {
+	SetDirty(ctx context.Context, d DirtyMigration) error
+	ClearDirty(ctx context.Context) error
+	Dirty(ctx context.Context) (DirtyMigration, bool, error)
+}
+
+// Dirty returns the interrupted migration, false if the log is clean (or doesn't track dirty state).
+func Dirty(log MigrationLog) (DirtyMigration, bool, error) {
+	return DirtyContext(context.Background(), log)
+}
+
+// DirtyContext is the same as Dirty but accepts a context.
+func DirtyContext(ctx context.Context, log MigrationLog) (DirtyMigration, bool, error) {
+	dirtyLog, ok := log.(MigrationLogDirty)
+
+	if !ok {
+		return DirtyMigration{}, false, nil
+	}
+
+	d, dirty, err := dirtyLog.Dirty(ctx)
+
+	if err != nil {
+		return DirtyMigration{}, false, fmt.Errorf("Dirty: unable to read dirty state: %w", err)
+	}
+
+	return d, dirty, nil
+}
+
+/*
+ForceClean clears the dirty state of the log, returning the migration which was
+interrupted. It should only be called once the database has been checked (and
+repaired) by hand, the log itself isn't modified so if the interrupted migration
+was applied it should be added with MarkApplied (or removed with MarkUnapplied
+if a rollback was applied).
+
+If the dirty state can't be read (e.g. the dirty file is corrupt) it is still
+cleared and the zero DirtyMigration is returned.
+*/
+func ForceClean(log MigrationLog) (DirtyMigration, error) {
+	return ForceCleanContext(context.Background(), log)
+}
+
+// ForceCleanContext is the same as ForceClean but accepts a context.
+func ForceCleanContext(ctx context.Context, log MigrationLog) (DirtyMigration, error) {
+	var d DirtyMigration
+
+	err := withLock(ctx, log, func() error {
+		var dirty bool
+		var err error
+
+		d, dirty, err = DirtyContext(ctx, log)
+
+		// An unreadable dirty state would otherwise block the log forever
+		if err == nil && !dirty {
+			return nil
+		}
+
+		err = log.(MigrationLogDirty).ClearDirty(ctx)
+
+		if err != nil {
+			return fmt.Errorf("ForceClean: unable to clear dirty state: %w", err)
+		}
+
+		return nil
+	})
+
+	return d, err
+}
+
+// Returns ErrDirty (with details of the interrupted migration) if the log is dirty
+func checkClean(ctx context.Context, log MigrationLog) error {
+	d, dirty, err := DirtyContext(ctx, log)
+
+	if err != nil {
+		return err
+	}
+
+	if dirty {
+		return fmt.Errorf("%w: %s was interrupted, check the database and call ForceClean", ErrDirty, d)
+	}
+
+	return nil
+}
+
+func logSetDirty(ctx context.Context, log MigrationLog, name string, direction Direction, step int) error {
+	if dirtyLog, ok := log.(MigrationLogDirty); ok {
+		return dirtyLog.SetDirty(ctx, DirtyMigration{
+			Name:      name,
+			Direction: direction,
+			Step:      step,
+			StartedAt: time.Now().UTC().Truncate(time.Second),
+		})
+	}
+
+	return nil
+}
+
+// Clears the dirty state even if the context has been cancelled (e.g. after the script was rolled back)
+func logClearDirty(ctx context.Context, log MigrationLog) error {
+	if dirtyLog, ok := log.(MigrationLogDirty); ok {
+		return dirtyLog.ClearDirty(context.WithoutCancel(ctx))
+	}
+
+	return nil
+}
+
+// Scans the row of a dirty table (name, direction, step, started_at) used by the SQL log drivers
+func scanDirty(row *sql.Row) (DirtyMigration, bool, error) {
+	var d DirtyMigration
+	var direction, startedAt string
+
+	err := row.Scan(&d.Name, &direction, &d.Step, &startedAt)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return DirtyMigration{}, false, nil
+	}
+
+	if err != nil {
+		return DirtyMigration{}, false, fmt.Errorf("unable to parse row: %w", err)
+	}
+
+	d.Direction = Direction(direction)
+	d.StartedAt, err = time.Parse(time.RFC3339, startedAt)
+
+	if err != nil {
+		return DirtyMigration{}, false, fmt.Errorf("invalid started_at: %w", err)
+	}
+
+	return d, true, nil
+}
@@ -0,0 +1,181 @@
+package migrate_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"testing"
+	"testing/fstest"
+
+	"github.com/jameswhoughton/migrate"
+)
+
+// Migrate() should leave the log dirty if a script fails outside of a transaction
+func TestMigrateFailureWithoutTransactionLeavesLogDirty(t *testing.T) {
+	db, _ := sql.Open("sqlite3", "test.db")
+	defer os.Remove("test.db")
+
+	log, err := migrate.NewLogSQLite(db)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testFs := fstest.MapFS{
+		"1_migration_up.sql": {Data: []byte("-- migrate:no-transaction\nCREATE TABLE users (id INT); I am not a valid query;")},
+		"2_migration_up.sql": {Data: []byte("CREATE TABLE posts (id INT);")},
+	}
+
+	err = migrate.Migrate(db, testFs, &log)
+
+	if err == nil {
+		t.Fatal("Expected error, got nil")
+	}
+
+	d, dirty, err := migrate.Dirty(&log)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !dirty {
+		t.Fatal("Expected log to be dirty")
+	}
+
+	if d.Name != "1_migration" || d.Direction != migrate.DirectionUp || d.Step != 1 || d.StartedAt.IsZero() {
+		t.Fatalf("Unexpected dirty migration %v", d)
+	}
+
+	err = migrate.Migrate(db, testFs, &log)
+
+	if !errors.Is(err, migrate.ErrDirty) {
+		t.Fatalf("Expected ErrDirty, got %v", err)
+	}
+
+	err = migrate.Rollback(db, testFs, &log)
+
+	if !errors.Is(err, migrate.ErrDirty) {
+		t.Fatalf("Expected ErrDirty, got %v", err)
+	}
+
+	if tableExists(db, "posts") {
+		t.Fatal("Expected no migrations to run while the log is dirty")
+	}
+}
+
+// Migrate() should leave the log clean if a script fails inside a transaction
+func TestMigrateFailureInTransactionLeavesLogClean(t *testing.T) {
+	db, _ := sql.Open("sqlite3", "test.db")
+	defer os.Remove("test.db")
+
+	log, err := migrate.NewLogSQLite(db)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testFs := fstest.MapFS{
+		"1_migration_up.sql": {Data: []byte("CREATE TABLE users (id INT); I am not a valid query;")},
+	}
+
+	err = migrate.Migrate(db, testFs, &log)
+
+	if err == nil {
+		t.Fatal("Expected error, got nil")
+	}
+
+	_, dirty, err := migrate.Dirty(&log)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if dirty {
+		t.Fatal("Expected log to be clean")
+	}
+}
+
+// Rollback() should leave the log dirty if a script fails outside of a transaction
+func TestRollbackFailureWithoutTransactionLeavesLogDirty(t *testing.T) {
+	db, _ := sql.Open("sqlite3", "test.db")
+	defer os.Remove("test.db")
+	defer os.RemoveAll(LOG_DIR)
+
+	log, err := migrate.NewLogFile(LOG_DIR + string(os.PathSeparator) + LOG_FILE)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testFs := fstest.MapFS{
+		"1_migration_up.sql":   {Data: []byte("CREATE TABLE users (id INT);")},
+		"1_migration_down.sql": {Data: []byte("-- migrate:no-transaction\nDROP TABLE users; I am not a valid query;")},
+	}
+
+	err = migrate.Migrate(db, testFs, &log)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = migrate.Rollback(db, testFs, &log)
+
+	if err == nil {
+		t.Fatal("Expected error, got nil")
+	}
+
+	d, dirty, err := migrate.Dirty(&log)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !dirty || d.Name != "1_migration" || d.Direction != migrate.DirectionDown || d.Step != 1 {
+		t.Fatalf("Unexpected dirty migration %v (dirty %t)", d, dirty)
+	}
+}
+
+// ForceClean() should return the interrupted migration and allow Migrate() to run again
+func TestForceCleanClearsDirtyLog(t *testing.T) {
+	db, _ := sql.Open("sqlite3", "test.db")
+	defer os.Remove("test.db")
+
+	log, err := migrate.NewLogSQLite(db)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := migrate.DirtyMigration{Name: "1_migration", Direction: migrate.DirectionUp, Step: 1}
+
+	err = log.SetDirty(context.Background(), expected)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := migrate.ForceClean(&log)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if d != expected {
+		t.Fatalf("Expected %v, got %v", expected, d)
+	}
+
+	testFs := fstest.MapFS{
+		"1_migration_up.sql": {Data: []byte("CREATE TABLE users (id INT);")},
+	}
+
+	err = migrate.Migrate(db, testFs, &log)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !tableExists(db, "users") {
+		t.Fatal("Expected users table to exist")
+	}
+}
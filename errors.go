@@ -0,0 +1,70 @@
+package migrate
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Returned by Rollback (and its variants) when the log is empty
+var ErrNothingToRollback = errors.New("no migrations to roll back")
+
+// Returned by MigrateTo (and PlanMigrateTo) when the target doesn't match a migration
+var ErrMigrationNotFound = errors.New("migration not found")
+
+// Returned when repairing the log if the migration is already in the log
+var ErrAlreadyApplied = errors.New("migration already applied")
+
+// Returned when repairing the log if the migration isn't in the log
+var ErrNotApplied = errors.New("migration not applied")
+
+/*
+Returned when a migration or rollback fails to run. Err is the error returned by
+the driver (or Go migration) so errors.As can be used to inspect it, for example
+to retrieve the MySQL error number.
+
+For SQL scripts Statement is the position (1-based) of the failing statement
+within the script and Line is the line on which it starts, both are 0 for Go
+migrations.
+*/
+type ErrorQuery struct {
+	// File name of the script or name of the Go migration
+	File      string
+	Direction Direction
+	// Step the migration was (or would have been) logged in
+	Step      int
+	Statement int
+	Line      int
+	Err       error
+}
+
+func (e ErrorQuery) Error() string {
+	if e.Statement == 0 {
+		return "error executing query in " + e.File + ": " + e.Err.Error()
+	}
+
+	return fmt.Sprintf("error executing statement %d (line %d) in %s: %v", e.Statement, e.Line, e.File, e.Err)
+}
+
+func (e ErrorQuery) Unwrap() error {
+	return e.Err
+}
+
+// Returns an ErrorQuery for the script, including the failing statement if known
+func newErrorQuery(s script, direction Direction, step int, err error) ErrorQuery {
+	e := ErrorQuery{
+		File:      s.source,
+		Direction: direction,
+		Step:      step,
+		Err:       err,
+	}
+
+	var stmtErr statementError
+
+	if errors.As(err, &stmtErr) {
+		e.Err = stmtErr.err
+		e.Statement = stmtErr.index
+		e.Line = stmtErr.line
+	}
+
+	return e
+}
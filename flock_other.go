@@ -0,0 +1,50 @@
+//go:build !unix || aix || solaris
+
+package migrate
+
+import (
+	"errors"
+	"os"
+)
+
+/*
+Creates the lock file, returns false if it already exists. Without flock the
+lock file isn't removed if the process exits while holding the lock, it must
+be removed manually.
+*/
+func tryLockFile(path string) (*os.File, bool, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0644)
+
+	if errors.Is(err, os.ErrExist) {
+		return nil, false, nil
+	}
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	return file, true, nil
+}
+
+// Releases the lock by removing the lock file
+func unlockFile(file *os.File) error {
+	file.Close()
+
+	return os.Remove(file.Name())
+}
+
+// Removes the lock file whichever process created it
+func forceUnlockFile(path string) error {
+	err := os.Remove(path)
+
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
+
+// Directories can't be synced on every platform, the rename is still atomic
+func syncDir(path string) error {
+	return nil
+}
@@ -0,0 +1,64 @@
+//go:build unix && !aix && !solaris
+
+package migrate
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+/*
+Takes an exclusive advisory lock (flock) on the file, returns false if the lock
+is held by another process (or another handle in this process). The lock is
+released by the OS if the process exits.
+*/
+func tryLockFile(path string) (*os.File, bool, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	err = syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+
+	if err != nil {
+		file.Close()
+
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, false, nil
+		}
+
+		return nil, false, err
+	}
+
+	return file, true, nil
+}
+
+// Releases the lock, the file is left in place as other processes may be waiting on it
+func unlockFile(file *os.File) error {
+	defer file.Close()
+
+	return syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+}
+
+/*
+The lock can't be left behind as it's released by the OS, removing the file
+while another process holds the lock would allow a third to take it.
+*/
+func forceUnlockFile(path string) error {
+	return ErrForceUnlockUnsupported
+}
+
+// Flushes the directory so a file renamed into it survives a crash
+func syncDir(path string) error {
+	dir, err := os.Open(path)
+
+	if err != nil {
+		return err
+	}
+
+	defer dir.Close()
+
+	return dir.Sync()
+}
@@ -0,0 +1,120 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+)
+
+/*
+Executor is implemented by both *sql.DB and *sql.Tx, Go migrations receive a
+*sql.Tx unless they are registered with RegisterNoTx in which case they
+receive the *sql.DB.
+*/
+type Executor interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// Function executed to apply or roll back a Go migration
+type GoMigrationFunc func(ctx context.Context, db Executor) error
+
+/*
+A migration implemented in Go rather than SQL, useful for data changes that
+need logic (batching, transforming data, calling helpers...). Down is optional,
+in the same way as rollback scripts.
+*/
+type GoMigration struct {
+	Name          string
+	Up            GoMigrationFunc
+	Down          GoMigrationFunc
+	NoTransaction bool
+}
+
+/*
+Registry wraps a migrations directory, adding Go migrations alongside the
+`.sql` scripts in the directory. A Registry can be passed to Migrate, Rollback
+(and every other function accepting a directory) in place of the directory.
+
+Go migrations are ordered by name along with the scripts, so should follow the
+same `{prefix}_{name}` format, for example:
+
+	directory := migrate.NewRegistry(os.DirFS("migrations"))
+
+	directory.Register("1700000000_backfill_users", backfillUp, backfillDown)
+
+	migrate.Migrate(db, directory, &log)
+
+Go migrations are logged and rolled back with the same step semantics as
+scripts, they are not checksummed so are ignored by Verify (unless missing).
+*/
+type Registry struct {
+	fs.FS
+	migrations map[string]GoMigration
+}
+
+// Returns a registry wrapping the directory
+func NewRegistry(directory fs.FS) *Registry {
+	return &Registry{
+		FS:         directory,
+		migrations: map[string]GoMigration{},
+	}
+}
+
+/*
+Register adds a Go migration which is executed within a transaction, down can
+be nil if the migration cannot be rolled back.
+*/
+func (r *Registry) Register(name string, up, down GoMigrationFunc) error {
+	return r.register(GoMigration{
+		Name: name,
+		Up:   up,
+		Down: down,
+	})
+}
+
+/*
+RegisterNoTx adds a Go migration which is executed outside of a transaction,
+the functions receive the *sql.DB.
+*/
+func (r *Registry) RegisterNoTx(name string, up, down GoMigrationFunc) error {
+	return r.register(GoMigration{
+		Name:          name,
+		Up:            up,
+		Down:          down,
+		NoTransaction: true,
+	})
+}
+
+func (r *Registry) register(migration GoMigration) error {
+	if migration.Name == "" {
+		return fmt.Errorf("Register: migration name must not be empty")
+	}
+
+	if migration.Up == nil {
+		return fmt.Errorf("Register: migration '%s' has no up function", migration.Name)
+	}
+
+	if _, exists := r.migrations[migration.Name]; exists {
+		return fmt.Errorf("Register: migration '%s' is already registered", migration.Name)
+	}
+
+	r.migrations[migration.Name] = migration
+
+	return nil
+}
+
+// Returns the Go migration with the given name if the directory is a registry
+func goMigration(directory fs.FS, name string) (GoMigration, bool) {
+	registry, ok := directory.(*Registry)
+
+	if !ok {
+		return GoMigration{}, false
+	}
+
+	migration, exists := registry.migrations[name]
+
+	return migration, exists
+}
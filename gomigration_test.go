@@ -0,0 +1,145 @@
+package migrate_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"testing"
+	"testing/fstest"
+
+	"github.com/jameswhoughton/migrate"
+)
+
+// Go migrations run in name order alongside scripts and are rolled back in the same step
+func TestGoMigrationsRunAlongsideScripts(t *testing.T) {
+	db, _ := sql.Open("sqlite3", "test.db")
+	defer os.Remove("test.db")
+
+	log := newTestLog()
+
+	directory := migrate.NewRegistry(fstest.MapFS{
+		"1_create_users_up.sql":   {Data: []byte("CREATE TABLE users (id INT PRIMARY KEY, name VARCHAR(100));")},
+		"1_create_users_down.sql": {Data: []byte("DROP TABLE users;")},
+		"3_add_index_up.sql":      {Data: []byte("CREATE INDEX users_name ON users (name);")},
+	})
+
+	err := directory.Register("2_seed_users", func(ctx context.Context, db migrate.Executor) error {
+		for i, name := range []string{"james", "sam"} {
+			_, err := db.ExecContext(ctx, "INSERT INTO users (id, name) VALUES (?, ?)", i, name)
+
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}, func(ctx context.Context, db migrate.Executor) error {
+		_, err := db.ExecContext(ctx, "DELETE FROM users")
+
+		return err
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = migrate.Migrate(db, directory, &log)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"1_create_users", "2_seed_users", "3_add_index"}
+
+	if len(log.store) != len(expected) {
+		t.Fatalf("Expected %d migrations, got %v", len(expected), log.store)
+	}
+
+	for i, name := range expected {
+		if log.store[i].Name != name || log.store[i].Step != 1 {
+			t.Errorf("Expected %s in step 1, got %v", name, log.store[i])
+		}
+	}
+
+	var count int
+
+	db.QueryRow("SELECT COUNT(*) FROM users").Scan(&count)
+
+	if count != 2 {
+		t.Errorf("Expected 2 users, got %d", count)
+	}
+
+	err = migrate.Rollback(db, directory, &log)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(log.store) != 0 {
+		t.Fatalf("Expected log to be empty, got %v", log.store)
+	}
+}
+
+// A failing Go migration is rolled back and not logged
+func TestFailingGoMigrationIsRolledBack(t *testing.T) {
+	db, _ := sql.Open("sqlite3", "test.db")
+	defer os.Remove("test.db")
+
+	log := newTestLog()
+
+	directory := migrate.NewRegistry(fstest.MapFS{
+		"1_create_users_up.sql": {Data: []byte("CREATE TABLE users (id INT PRIMARY KEY, name VARCHAR(100));")},
+	})
+
+	failure := errors.New("backfill failed")
+
+	directory.Register("2_seed_users", func(ctx context.Context, db migrate.Executor) error {
+		_, err := db.ExecContext(ctx, "INSERT INTO users (id, name) VALUES (1, 'james')")
+
+		if err != nil {
+			return err
+		}
+
+		return failure
+	}, nil)
+
+	err := migrate.Migrate(db, directory, &log)
+
+	if err == nil {
+		t.Fatal("Expected error, got nil")
+	}
+
+	if len(log.store) != 1 {
+		t.Fatalf("Expected only 1_create_users to be logged, got %v", log.store)
+	}
+
+	var count int
+
+	db.QueryRow("SELECT COUNT(*) FROM users").Scan(&count)
+
+	if count != 0 {
+		t.Errorf("Expected insert to be rolled back, found %d users", count)
+	}
+}
+
+// Register() rejects duplicate names
+func TestRegisterRejectsDuplicateNames(t *testing.T) {
+	directory := migrate.NewRegistry(fstest.MapFS{})
+
+	noop := func(ctx context.Context, db migrate.Executor) error {
+		return nil
+	}
+
+	err := directory.Register("1_migration", noop, nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = directory.RegisterNoTx("1_migration", noop, nil)
+
+	if err == nil {
+		t.Fatal("Expected error, got nil")
+	}
+}
@@ -1,6 +1,13 @@
 package migrate_test
 
-import "github.com/jameswhoughton/migrate"
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/jameswhoughton/migrate"
+)
 
 // This is an in memory log specifically for use in tests
 type testLog struct {
@@ -46,6 +53,124 @@ func (ml *testLog) LastStep() int {
 	return ml.store[lastIndex].Step
 }
 
+func (ml *testLog) List() ([]migrate.Migration, error) {
+	migrations := make([]migrate.Migration, len(ml.store))
+
+	copy(migrations, ml.store)
+
+	return migrations, nil
+}
+
 func newTestLog() testLog {
 	return testLog{}
 }
+
+// Returns true if the table exists in the SQLite database
+func tableExists(db *sql.DB, table string) bool {
+	var name string
+
+	err := db.QueryRow("SELECT name FROM sqlite_master WHERE type = 'table' AND name = ?", table).Scan(&name)
+
+	return err == nil
+}
+
+// Checks SetDirty(), Dirty() and ClearDirty() round trip on the given log
+func testDirtyRoundTrip(t *testing.T, log migrate.MigrationLogDirty) {
+	t.Helper()
+
+	ctx := context.Background()
+
+	_, dirty, err := log.Dirty(ctx)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if dirty {
+		t.Fatal("Expected new log to be clean")
+	}
+
+	// The comma and percent sign must survive logs which escape the name
+	expected := migrate.DirtyMigration{
+		Name:      "1_create_users,100%",
+		Direction: migrate.DirectionDown,
+		Step:      3,
+		StartedAt: time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC),
+	}
+
+	if err := log.SetDirty(ctx, expected); err != nil {
+		t.Fatal(err)
+	}
+
+	got, dirty, err := log.Dirty(ctx)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !dirty || got != expected {
+		t.Fatalf("Expected %v, got %v (dirty %t)", expected, got, dirty)
+	}
+
+	if err := log.ClearDirty(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	_, dirty, err = log.Dirty(ctx)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if dirty {
+		t.Fatal("Expected log to be clean after ClearDirty")
+	}
+}
+
+// Checks AddHistory() and History() with each filter on the given log
+func testHistoryRoundTrip(t *testing.T, log migrate.MigrationLogHistory) {
+	t.Helper()
+
+	ctx := context.Background()
+	day := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	events := []migrate.HistoryEvent{
+		{Name: "1_a", Step: 1, Direction: migrate.DirectionUp, Outcome: migrate.OutcomeSuccess, Time: day, Duration: 20 * time.Millisecond, Executor: "ci", Label: "v1, beta"},
+		{Name: "2_b", Step: 1, Direction: migrate.DirectionUp, Outcome: migrate.OutcomeFailure, Error: "syntax error, near \"I\"", Time: day.Add(time.Hour)},
+		{Name: "1_a", Step: 1, Direction: migrate.DirectionDown, Outcome: migrate.OutcomeSuccess, Time: day.Add(48 * time.Hour)},
+	}
+
+	for _, e := range events {
+		if err := log.AddHistory(ctx, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		name     string
+		filter   migrate.HistoryFilter
+		expected []migrate.HistoryEvent
+	}{
+		{"all", migrate.HistoryFilter{}, events},
+		{"name", migrate.HistoryFilter{Name: "1_a"}, []migrate.HistoryEvent{events[0], events[2]}},
+		{"range", migrate.HistoryFilter{Since: day.Add(time.Hour), Until: day.Add(48 * time.Hour)}, events[1:2]},
+	}
+
+	for _, c := range cases {
+		got, err := log.History(ctx, c.filter)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(got) != len(c.expected) {
+			t.Fatalf("%s: expected %d events, got %d", c.name, len(c.expected), len(got))
+		}
+
+		for i, e := range c.expected {
+			if got[i] != e {
+				t.Errorf("%s: expected %v, got %v", c.name, e, got[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Returned by History when the log isn't recording history (see WithHistory)
+var ErrHistoryDisabled = errors.New("log history is not enabled")
+
+// Outcome of a HistoryEvent
+type Outcome string
+
+const (
+	OutcomeSuccess Outcome = "success"
+	OutcomeFailure Outcome = "failure"
+)
+
+/*
+An attempt to apply (DirectionUp) or roll back (DirectionDown) a migration.
+Time is when the attempt finished (UTC, to the second) and Error is the error
+message if the attempt failed.
+*/
+type HistoryEvent struct {
+	Name      string
+	Step      int
+	Direction Direction
+	Outcome   Outcome
+	Error     string
+	Time      time.Time
+	Duration  time.Duration
+	Executor  string
+	Label     string
+}
+
+/*
+Selects the events returned by History, the zero value selects every event.
+Since is inclusive and Until is exclusive.
+*/
+type HistoryFilter struct {
+	Name  string
+	Since time.Time
+	Until time.Time
+}
+
+// Returns true if the event is selected by the filter
+func (f HistoryFilter) matches(e HistoryEvent) bool {
+	if f.Name != "" && e.Name != f.Name {
+		return false
+	}
+
+	if !f.Since.IsZero() && e.Time.Before(f.Since) {
+		return false
+	}
+
+	if !f.Until.IsZero() && !e.Time.Before(f.Until) {
+		return false
+	}
+
+	return true
+}
+
+/*
+Optional extension of MigrationLog which keeps an append-only history of every
+apply and rollback, unlike the log itself events are never removed so the
+history shows migrations which have since been rolled back.
+
+Migrate and Rollback call AddHistory after each attempt (successful or not).
+History should return the selected events in the order they were added, or
+ErrHistoryDisabled if the log isn't recording history. The log drivers in the
+package implement MigrationLogHistory, history is recorded if the log was
+created with the WithHistory option.
+*/
+type MigrationLogHistory interface {
+	AddHistory(ctx context.Context, e HistoryEvent) error
+	History(ctx context.Context, filter HistoryFilter) ([]HistoryEvent, error)
+}
+
+// History returns the events in the history of the log selected by the filter.
+func History(log MigrationLog, filter HistoryFilter) ([]HistoryEvent, error) {
+	return HistoryContext(context.Background(), log, filter)
+}
+
+// HistoryContext is the same as History but accepts a context.
+func HistoryContext(ctx context.Context, log MigrationLog, filter HistoryFilter) ([]HistoryEvent, error) {
+	historyLog, ok := log.(MigrationLogHistory)
+
+	if !ok {
+		return nil, fmt.Errorf("History: %w", ErrHistoryDisabled)
+	}
+
+	events, err := historyLog.History(ctx, filter)
+
+	if err != nil {
+		return nil, fmt.Errorf("History: %w", err)
+	}
+
+	return events, nil
+}
+
+/*
+Adds the outcome of applying or rolling back the migration to the history of
+the log, the event is recorded even if the context has been cancelled.
+*/
+func logHistory(ctx context.Context, log MigrationLog, m Migration, direction Direction, start time.Time, err error) error {
+	historyLog, ok := log.(MigrationLogHistory)
+
+	if !ok {
+		return nil
+	}
+
+	e := HistoryEvent{
+		Name:      m.Name,
+		Step:      m.Step,
+		Direction: direction,
+		Outcome:   OutcomeSuccess,
+		Time:      time.Now().UTC().Truncate(time.Second),
+		Duration:  time.Since(start).Truncate(time.Millisecond),
+		Executor:  executorFromContext(ctx),
+		Label:     labelFromContext(ctx),
+	}
+
+	if err != nil {
+		e.Outcome = OutcomeFailure
+		e.Error = err.Error()
+	}
+
+	return historyLog.AddHistory(context.WithoutCancel(ctx), e)
+}
+
+// Columns of the history table read and written by the SQL log drivers
+const historyColumns = "name, step, direction, outcome, error_message, occurred_at, duration_ms, executor, label"
+
+// Values of historyColumns for the event
+func historyValues(e HistoryEvent) []any {
+	return []any{e.Name, e.Step, string(e.Direction), string(e.Outcome), e.Error, formatAppliedAt(e.Time), e.Duration.Milliseconds(), e.Executor, e.Label}
+}
+
+/*
+Returns the query selecting the events of the history table matching the
+filter, placeholder returns the placeholder of the nth (from 1) argument.
+*/
+func historyQuery(table string, filter HistoryFilter, placeholder func(n int) string) (string, []any) {
+	var conditions []string
+	var args []any
+
+	add := func(condition string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, condition+placeholder(len(args)))
+	}
+
+	if filter.Name != "" {
+		add("name = ", filter.Name)
+	}
+
+	// The times are stored as RFC 3339 in UTC so compare in the same order as strings
+	if !filter.Since.IsZero() {
+		add("occurred_at >= ", formatAppliedAt(filter.Since.UTC()))
+	}
+
+	if !filter.Until.IsZero() {
+		add("occurred_at < ", formatAppliedAt(filter.Until.UTC()))
+	}
+
+	query := "SELECT " + historyColumns + " FROM " + table
+
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	return query + " ORDER BY id", args
+}
+
+// Scans a row of historyColumns
+func scanHistoryEvent(row rowScanner) (HistoryEvent, error) {
+	var e HistoryEvent
+	var direction, outcome, occurredAt string
+	var durationMs int64
+
+	err := row.Scan(&e.Name, &e.Step, &direction, &outcome, &e.Error, &occurredAt, &durationMs, &e.Executor, &e.Label)
+
+	if err != nil {
+		return HistoryEvent{}, err
+	}
+
+	e.Direction = Direction(direction)
+	e.Outcome = Outcome(outcome)
+	e.Duration = time.Duration(durationMs) * time.Millisecond
+	e.Time, err = parseAppliedAt(occurredAt)
+
+	if err != nil {
+		return HistoryEvent{}, err
+	}
+
+	return e, nil
+}
@@ -0,0 +1,111 @@
+package migrate_test
+
+import (
+	"database/sql"
+	"errors"
+	"os"
+	"testing"
+	"testing/fstest"
+
+	"github.com/jameswhoughton/migrate"
+)
+
+// Migrate() and Rollback() should append every attempt to the history, which is kept after a rollback
+func TestHistoryRecordsAppliesAndRollbacks(t *testing.T) {
+	db, _ := sql.Open("sqlite3", "test.db")
+	defer os.Remove("test.db")
+
+	log, err := migrate.NewLogSQLite(db, migrate.WithHistory())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testFs := fstest.MapFS{
+		"1_migration_up.sql":   {Data: []byte("CREATE TABLE users (id INT);")},
+		"1_migration_down.sql": {Data: []byte("DROP TABLE users;")},
+		"2_migration_up.sql":   {Data: []byte("I am not a valid query;")},
+	}
+
+	err = migrate.Migrate(db, testFs, &log)
+
+	if err == nil {
+		t.Fatal("Expected error, got nil")
+	}
+
+	err = migrate.Rollback(db, testFs, &log)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := migrate.History(&log, migrate.HistoryFilter{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []struct {
+		name      string
+		direction migrate.Direction
+		outcome   migrate.Outcome
+	}{
+		{"1_migration", migrate.DirectionUp, migrate.OutcomeSuccess},
+		{"2_migration", migrate.DirectionUp, migrate.OutcomeFailure},
+		{"1_migration", migrate.DirectionDown, migrate.OutcomeSuccess},
+	}
+
+	if len(events) != len(expected) {
+		t.Fatalf("Expected %d events, got %d", len(expected), len(events))
+	}
+
+	for i, e := range expected {
+		if events[i].Name != e.name || events[i].Direction != e.direction || events[i].Outcome != e.outcome || events[i].Step != 1 {
+			t.Errorf("Expected %s %s %s, got %v", e.name, e.direction, e.outcome, events[i])
+		}
+	}
+
+	if events[1].Error == "" {
+		t.Error("Expected the failure to record the error")
+	}
+
+	events, err = migrate.History(&log, migrate.HistoryFilter{Name: "1_migration"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 events for 1_migration, got %d", len(events))
+	}
+}
+
+// History() should return ErrHistoryDisabled unless the log was created WithHistory
+func TestHistoryDisabledByDefault(t *testing.T) {
+	db, _ := sql.Open("sqlite3", "test.db")
+	defer os.Remove("test.db")
+
+	log, err := migrate.NewLogSQLite(db)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = migrate.History(&log, migrate.HistoryFilter{})
+
+	if !errors.Is(err, migrate.ErrHistoryDisabled) {
+		t.Fatalf("Expected ErrHistoryDisabled, got %v", err)
+	}
+
+	if tableExists(db, "migrations_history") {
+		t.Fatal("Expected migrations_history table not to be created")
+	}
+
+	testLog := newTestLog()
+
+	_, err = migrate.History(&testLog, migrate.HistoryFilter{})
+
+	if !errors.Is(err, migrate.ErrHistoryDisabled) {
+		t.Fatalf("Expected ErrHistoryDisabled, got %v", err)
+	}
+}
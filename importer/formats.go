@@ -0,0 +1,409 @@
+package importer
+
+import (
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jameswhoughton/migrate"
+)
+
+/*
+Convert reads the migrations in the source directory (in the format of the
+given tool) and converts them into this library's format, ordered by version.
+
+Only SQL migrations can be converted, an error is returned if the directory
+contains migrations which would be skipped (e.g. goose Go migrations or Flyway
+repeatable migrations) so that they can be ported manually.
+*/
+func Convert(format Format, source fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(source, ".")
+
+	if err != nil {
+		return nil, fmt.Errorf("Convert: unable to read directory: %w", err)
+	}
+
+	var files []string
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			files = append(files, entry.Name())
+		}
+	}
+
+	var migrations []Migration
+
+	switch format {
+	case GolangMigrate:
+		migrations, err = convertGolangMigrate(source, files)
+	case Goose:
+		migrations, err = convertSections(source, files, parseGoose)
+	case Dbmate:
+		migrations, err = convertSections(source, files, parseDbmate)
+	case Flyway:
+		migrations, err = convertFlyway(source, files)
+	default:
+		_, err = ParseFormat(string(format))
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("Convert: %w", err)
+	}
+
+	return migrations, nil
+}
+
+var golangMigrateRegexp = regexp.MustCompile(`^(\d+)_(.*)\.(up|down)\.sql$`)
+
+func convertGolangMigrate(source fs.FS, files []string) ([]Migration, error) {
+	byVersion := map[string]*Migration{}
+
+	for _, file := range files {
+		parts := golangMigrateRegexp.FindStringSubmatch(file)
+
+		if parts == nil {
+			continue
+		}
+
+		version, prefix, err := numericVersion(parts[1])
+
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+
+		query, err := fs.ReadFile(source, file)
+
+		if err != nil {
+			return nil, err
+		}
+
+		m, exists := byVersion[version]
+
+		if !exists {
+			m = &Migration{
+				Version: version,
+				Name:    migrationName(prefix, parts[2]),
+			}
+
+			byVersion[version] = m
+		}
+
+		if parts[3] == "up" {
+			m.Up = query
+		} else {
+			m.Down = query
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+
+	for _, m := range byVersion {
+		if m.Up == nil {
+			return nil, fmt.Errorf("version %s has a down migration but no up migration", m.Version)
+		}
+
+		migrations = append(migrations, *m)
+	}
+
+	return migrations, sortByName(migrations)
+}
+
+var versionedFileRegexp = regexp.MustCompile(`^(\d+)_(.*)\.(sql|go)$`)
+
+// Parses the up and down scripts from a file containing both
+type sectionParser func(query string) (up, down []byte, err error)
+
+// Converts tools which keep both sections in a single `{version}_{name}.sql` file
+func convertSections(source fs.FS, files []string, parse sectionParser) ([]Migration, error) {
+	var migrations []Migration
+
+	for _, file := range files {
+		parts := versionedFileRegexp.FindStringSubmatch(file)
+
+		if parts == nil {
+			continue
+		}
+
+		if parts[3] == "go" {
+			return nil, fmt.Errorf("%s: Go migrations cannot be imported, port it to a migrate.Registry", file)
+		}
+
+		version, prefix, err := numericVersion(parts[1])
+
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+
+		query, err := fs.ReadFile(source, file)
+
+		if err != nil {
+			return nil, err
+		}
+
+		up, down, err := parse(string(query))
+
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+
+		migrations = append(migrations, Migration{
+			Version: version,
+			Name:    migrationName(prefix, parts[2]),
+			Up:      up,
+			Down:    down,
+		})
+	}
+
+	return migrations, sortByName(migrations)
+}
+
+/*
+Parses a goose migration, StatementBegin/StatementEnd blocks are converted to
+DELIMITER lines and NO TRANSACTION to the no-transaction directive.
+*/
+func parseGoose(query string) ([]byte, []byte, error) {
+	var up, down *strings.Builder
+	var current *strings.Builder
+	noTransaction := false
+
+	for _, line := range strings.Split(query, "\n") {
+		trimmed := strings.TrimSpace(line)
+
+		if !strings.HasPrefix(trimmed, "-- +goose ") {
+			if current != nil {
+				current.WriteString(line + "\n")
+			}
+
+			continue
+		}
+
+		switch annotation := strings.ToUpper(strings.TrimSpace(strings.TrimPrefix(trimmed, "-- +goose "))); annotation {
+		case "UP":
+			up = &strings.Builder{}
+			current = up
+		case "DOWN":
+			down = &strings.Builder{}
+			current = down
+		case "STATEMENTBEGIN":
+			if current != nil {
+				current.WriteString("DELIMITER //\n")
+			}
+		case "STATEMENTEND":
+			if current != nil {
+				current.WriteString("//\nDELIMITER ;\n")
+			}
+		case "NO TRANSACTION":
+			noTransaction = true
+		case "ENVSUB ON", "ENVSUB OFF":
+			// Environment substitution isn't supported, the script is kept as is
+		default:
+			return nil, nil, fmt.Errorf("unsupported annotation '%s'", trimmed)
+		}
+	}
+
+	if up == nil {
+		return nil, nil, fmt.Errorf("missing '-- +goose Up' annotation")
+	}
+
+	return sectionScript(up, noTransaction), sectionScript(down, noTransaction), nil
+}
+
+// Parses a dbmate migration, `transaction:false` is converted to the no-transaction directive
+func parseDbmate(query string) ([]byte, []byte, error) {
+	var up, down *strings.Builder
+	var current *strings.Builder
+	noTransaction := map[*strings.Builder]bool{}
+
+	for _, line := range strings.Split(query, "\n") {
+		fields := strings.Fields(line)
+
+		if len(fields) < 2 || fields[0] != "--" || (fields[1] != "migrate:up" && fields[1] != "migrate:down") {
+			if current != nil {
+				current.WriteString(line + "\n")
+			}
+
+			continue
+		}
+
+		current = &strings.Builder{}
+
+		if fields[1] == "migrate:up" {
+			up = current
+		} else {
+			down = current
+		}
+
+		for _, option := range fields[2:] {
+			if option == "transaction:false" {
+				noTransaction[current] = true
+			}
+		}
+	}
+
+	if up == nil {
+		return nil, nil, fmt.Errorf("missing '-- migrate:up' section")
+	}
+
+	return sectionScript(up, noTransaction[up]), sectionScript(down, noTransaction[down]), nil
+}
+
+// Returns the script for a section, nil if the section doesn't exist
+func sectionScript(section *strings.Builder, noTransaction bool) []byte {
+	if section == nil {
+		return nil
+	}
+
+	query := strings.TrimSpace(section.String()) + "\n"
+
+	if noTransaction {
+		query = migrate.NoTransactionDirective + "\n" + query
+	}
+
+	return []byte(query)
+}
+
+var flywayRegexp = regexp.MustCompile(`^([VUR])(.*?)__(.*)\.sql$`)
+
+func convertFlyway(source fs.FS, files []string) ([]Migration, error) {
+	byVersion := map[string]*Migration{}
+	descriptions := map[string]string{}
+
+	for _, file := range files {
+		parts := flywayRegexp.FindStringSubmatch(file)
+
+		if parts == nil {
+			continue
+		}
+
+		if parts[1] == "R" {
+			return nil, fmt.Errorf("%s: repeatable migrations cannot be imported", file)
+		}
+
+		version, err := flywayVersion(parts[2])
+
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+
+		query, err := fs.ReadFile(source, file)
+
+		if err != nil {
+			return nil, err
+		}
+
+		m, exists := byVersion[version]
+
+		if !exists {
+			m = &Migration{Version: version}
+			byVersion[version] = m
+		}
+
+		if parts[1] == "V" {
+			m.Up = query
+			descriptions[version] = parts[3]
+		} else {
+			m.Down = query
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+
+	for _, m := range byVersion {
+		if m.Up == nil {
+			return nil, fmt.Errorf("version %s has an undo migration but no versioned migration", m.Version)
+		}
+
+		migrations = append(migrations, *m)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return compareFlywayVersions(migrations[i].Version, migrations[j].Version) < 0
+	})
+
+	// Flyway versions aren't necessarily integers so the position is used as the prefix
+	for i := range migrations {
+		migrations[i].Name = migrationName(int64(i+1), descriptions[migrations[i].Version])
+	}
+
+	return migrations, nil
+}
+
+// Returns the version without leading zeros and the prefix for the migration name
+func numericVersion(version string) (string, int64, error) {
+	prefix, err := strconv.ParseInt(version, 10, 64)
+
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid version '%s'", version)
+	}
+
+	return strconv.FormatInt(prefix, 10), prefix, nil
+}
+
+// Sorts the migrations by name (and therefore version), returning an error if a version is duplicated
+func sortByName(migrations []Migration) error {
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Name < migrations[j].Name
+	})
+
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].Version == migrations[i-1].Version {
+			return fmt.Errorf("version %s is used by more than one migration", migrations[i].Version)
+		}
+	}
+
+	return nil
+}
+
+// Normalises a Flyway version, e.g. `1_02` becomes `1.2` (the format stored in the history table)
+func flywayVersion(version string) (string, error) {
+	parts := strings.FieldsFunc(version, func(r rune) bool {
+		return r == '.' || r == '_'
+	})
+
+	if len(parts) == 0 {
+		return "", fmt.Errorf("invalid version '%s'", version)
+	}
+
+	for i, part := range parts {
+		n, err := strconv.ParseUint(part, 10, 64)
+
+		if err != nil {
+			return "", fmt.Errorf("invalid version '%s'", version)
+		}
+
+		parts[i] = strconv.FormatUint(n, 10)
+	}
+
+	return strings.Join(parts, "."), nil
+}
+
+// Compares two normalised Flyway versions, returning -1, 0 or 1
+func compareFlywayVersions(a, b string) int {
+	aParts := strings.Split(a, ".")
+	bParts := strings.Split(b, ".")
+
+	for i := 0; i < max(len(aParts), len(bParts)); i++ {
+		var x, y uint64
+
+		if i < len(aParts) {
+			x, _ = strconv.ParseUint(aParts[i], 10, 64)
+		}
+
+		if i < len(bParts) {
+			y, _ = strconv.ParseUint(bParts[i], 10, 64)
+		}
+
+		if x != y {
+			if x < y {
+				return -1
+			}
+
+			return 1
+		}
+	}
+
+	return 0
+}
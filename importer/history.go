@@ -0,0 +1,232 @@
+package importer
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// Default name of each tool's history table
+var defaultTables = map[Format]string{
+	GolangMigrate: "schema_migrations",
+	Goose:         "goose_db_version",
+	Dbmate:        "schema_migrations",
+	Flyway:        "flyway_schema_history",
+}
+
+// Table names are interpolated into queries so are restricted to (optionally schema qualified) identifiers
+var tableRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+/*
+Applied reads the other tool's history table and returns the converted migrations
+which have been applied, in order. If table is empty the tool's default table is
+used (e.g. `goose_db_version`).
+
+An error is returned if the history contains a version that isn't in migrations
+(as it couldn't be rolled back) or if golang-migrate's history is dirty.
+*/
+func Applied(ctx context.Context, format Format, db *sql.DB, table string, migrations []Migration) ([]Migration, error) {
+	if table == "" {
+		table = defaultTables[format]
+	}
+
+	if !tableRegexp.MatchString(table) {
+		return nil, fmt.Errorf("Applied: invalid table name '%s'", table)
+	}
+
+	var versions map[string]bool
+	var err error
+
+	switch format {
+	case GolangMigrate:
+		versions, err = appliedGolangMigrate(ctx, db, table, migrations)
+	case Goose:
+		versions, err = appliedGoose(ctx, db, table)
+	case Dbmate:
+		versions, err = appliedDbmate(ctx, db, table)
+	case Flyway:
+		versions, err = appliedFlyway(ctx, db, table, migrations)
+	default:
+		_, err = ParseFormat(string(format))
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("Applied: %w", err)
+	}
+
+	applied := []Migration{}
+
+	for _, m := range migrations {
+		if versions[m.Version] {
+			applied = append(applied, m)
+			delete(versions, m.Version)
+		}
+	}
+
+	for version, isApplied := range versions {
+		if isApplied {
+			return nil, fmt.Errorf("Applied: version %s has been applied but no migration was found", version)
+		}
+	}
+
+	return applied, nil
+}
+
+// golang-migrate only stores the current version, every migration up to and including it has been applied
+func appliedGolangMigrate(ctx context.Context, db *sql.DB, table string, migrations []Migration) (map[string]bool, error) {
+	var version int64
+	var dirty bool
+
+	err := db.QueryRowContext(ctx, "SELECT version, dirty FROM "+table).Scan(&version, &dirty)
+
+	if err == sql.ErrNoRows {
+		return map[string]bool{}, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to read %s: %w", table, err)
+	}
+
+	if dirty {
+		return nil, fmt.Errorf("%s is dirty at version %d, fix the database before importing", table, version)
+	}
+
+	versions := map[string]bool{}
+
+	if version < 0 {
+		return versions, nil
+	}
+
+	current := strconv.FormatInt(version, 10)
+	found := false
+
+	for _, m := range migrations {
+		prefix, _ := strconv.ParseInt(m.Version, 10, 64)
+
+		if prefix <= version {
+			versions[m.Version] = true
+		}
+
+		found = found || m.Version == current
+	}
+
+	if !found {
+		versions[current] = true
+	}
+
+	return versions, nil
+}
+
+// goose adds a row each time a migration is applied or rolled back, the most recent row wins
+func appliedGoose(ctx context.Context, db *sql.DB, table string) (map[string]bool, error) {
+	rows, err := db.QueryContext(ctx, "SELECT version_id, is_applied FROM "+table+" ORDER BY id")
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to read %s: %w", table, err)
+	}
+
+	defer rows.Close()
+
+	versions := map[string]bool{}
+
+	for rows.Next() {
+		var version int64
+		var isApplied bool
+
+		if err := rows.Scan(&version, &isApplied); err != nil {
+			return nil, fmt.Errorf("unable to parse row: %w", err)
+		}
+
+		// Version 0 is added by goose when the table is created
+		if version == 0 {
+			continue
+		}
+
+		versions[strconv.FormatInt(version, 10)] = isApplied
+	}
+
+	return versions, rows.Err()
+}
+
+// dbmate stores a row for each applied migration
+func appliedDbmate(ctx context.Context, db *sql.DB, table string) (map[string]bool, error) {
+	rows, err := db.QueryContext(ctx, "SELECT version FROM "+table)
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to read %s: %w", table, err)
+	}
+
+	defer rows.Close()
+
+	versions := map[string]bool{}
+
+	for rows.Next() {
+		var version string
+
+		if err := rows.Scan(&version); err != nil {
+			return nil, fmt.Errorf("unable to parse row: %w", err)
+		}
+
+		version, _, err = numericVersion(version)
+
+		if err != nil {
+			return nil, err
+		}
+
+		versions[version] = true
+	}
+
+	return versions, rows.Err()
+}
+
+/*
+Flyway adds a row for each successful (or failed) migration, undo and baseline,
+migrations up to and including a baseline are treated as applied.
+*/
+func appliedFlyway(ctx context.Context, db *sql.DB, table string, migrations []Migration) (map[string]bool, error) {
+	rows, err := db.QueryContext(ctx, "SELECT version, type, success FROM "+table+" WHERE version IS NOT NULL ORDER BY installed_rank")
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to read %s: %w", table, err)
+	}
+
+	defer rows.Close()
+
+	versions := map[string]bool{}
+
+	for rows.Next() {
+		var version, migrationType string
+		var success bool
+
+		if err := rows.Scan(&version, &migrationType, &success); err != nil {
+			return nil, fmt.Errorf("unable to parse row: %w", err)
+		}
+
+		version, err = flywayVersion(version)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !success {
+			continue
+		}
+
+		switch migrationType {
+		case "UNDO_SQL":
+			versions[version] = false
+		case "BASELINE":
+			for _, m := range migrations {
+				if compareFlywayVersions(m.Version, version) <= 0 {
+					versions[m.Version] = true
+				}
+			}
+		default:
+			versions[version] = true
+		}
+	}
+
+	return versions, rows.Err()
+}
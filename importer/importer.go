@@ -0,0 +1,161 @@
+/*
+Converts migration directories and history tables from other migration tools
+into the format used by https://github.com/jameswhoughton/migrate.
+
+The following tools are supported:
+
+  - golang-migrate: `{version}_{title}.up.sql` and `{version}_{title}.down.sql`
+  - goose: `{version}_{name}.sql` with `-- +goose Up` and `-- +goose Down` sections
+  - dbmate: `{version}_{name}.sql` with `-- migrate:up` and `-- migrate:down` sections
+  - Flyway: `V{version}__{description}.sql` with optional `U{version}__{description}.sql` undo scripts
+
+A typical import converts the directory, writes the converted scripts, reads the
+versions applied by the other tool and adds them to the log:
+
+	migrations, err := importer.Convert(importer.Goose, os.DirFS("db/migrations"))
+	_, err = importer.Write("migrations", migrations)
+	applied, err := importer.Applied(ctx, importer.Goose, db, "", migrations)
+	_, err = importer.Seed(&log, applied)
+*/
+package importer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/jameswhoughton/migrate"
+)
+
+// Migration tool from which migrations are imported
+type Format string
+
+const (
+	GolangMigrate Format = "golang-migrate"
+	Goose         Format = "goose"
+	Dbmate        Format = "dbmate"
+	Flyway        Format = "flyway"
+)
+
+// Returns the format with the given name, e.g. "goose"
+func ParseFormat(name string) (Format, error) {
+	switch format := Format(name); format {
+	case GolangMigrate, Goose, Dbmate, Flyway:
+		return format, nil
+	}
+
+	return "", fmt.Errorf("unsupported format '%s', expected golang-migrate, goose, dbmate or flyway", name)
+}
+
+/*
+A migration converted from another tool. Version is the version used by the
+other tool and Name is the name of the migration in this library's format
+(`{prefix}_{name}`), the prefix is the version zero padded to 19 digits (the
+length of the timestamps used by createmigration) so the imported migrations
+are ordered correctly and run before any migrations created afterwards. Flyway
+versions (e.g. `1.2`) are replaced by their position.
+
+Down is nil if the migration doesn't have a rollback.
+*/
+type Migration struct {
+	Version string
+	Name    string
+	Up      []byte
+	Down    []byte
+}
+
+// Width of the prefix of imported migrations
+const prefixWidth = 19
+
+var illegalCharacterRegexp = regexp.MustCompile(`[^a-zA-Z\d]+`)
+
+// Returns the name of the migration in this library's format
+func migrationName(prefix int64, description string) string {
+	description = strings.Trim(illegalCharacterRegexp.ReplaceAllString(description, "_"), "_")
+
+	return fmt.Sprintf("%0*d_%s", prefixWidth, prefix, description)
+}
+
+/*
+Write creates the `_up.sql` and `_down.sql` scripts for the migrations in the
+directory (creating it if required), returning the names of the created files.
+Existing files are never overwritten, an error is returned instead.
+*/
+func Write(directory string, migrations []Migration) ([]string, error) {
+	err := os.MkdirAll(directory, 0755)
+
+	if err != nil {
+		return nil, fmt.Errorf("Write: unable to create directory: %w", err)
+	}
+
+	var created []string
+
+	for _, m := range migrations {
+		scripts := []struct {
+			suffix string
+			query  []byte
+		}{{"_up.sql", m.Up}}
+
+		if m.Down != nil {
+			scripts = append(scripts, struct {
+				suffix string
+				query  []byte
+			}{"_down.sql", m.Down})
+		}
+
+		for _, s := range scripts {
+			fileName := m.Name + s.suffix
+
+			err := writeNew(filepath.Join(directory, fileName), s.query)
+
+			if err != nil {
+				return created, fmt.Errorf("Write: unable to write %s: %w", fileName, err)
+			}
+
+			created = append(created, fileName)
+		}
+	}
+
+	return created, nil
+}
+
+// Writes the file, failing if it already exists
+func writeNew(path string, data []byte) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(data)
+
+	return errors.Join(err, file.Close())
+}
+
+/*
+Seed adds the applied migrations to the log in a single new step, migrations
+which are already in the log are skipped. The added entries are returned. The
+log is locked while the migrations are added and ErrDirty is returned if it is
+dirty (see migrate.Seed).
+
+Imported migrations are logged without a checksum so they are not checked by
+migrate.Verify.
+*/
+func Seed(log migrate.MigrationLog, applied []Migration) ([]migrate.Migration, error) {
+	return SeedContext(context.Background(), log, applied)
+}
+
+// SeedContext is the same as Seed but accepts a context.
+func SeedContext(ctx context.Context, log migrate.MigrationLog, applied []Migration) ([]migrate.Migration, error) {
+	names := make([]string, len(applied))
+
+	for i, m := range applied {
+		names[i] = m.Name
+	}
+
+	return migrate.SeedContext(ctx, log, names)
+}
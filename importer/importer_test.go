@@ -0,0 +1,370 @@
+package importer_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/jameswhoughton/migrate"
+	"github.com/jameswhoughton/migrate/importer"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const MIGRATION_DIR = "migrations_test"
+
+func names(migrations []importer.Migration) []string {
+	var names []string
+
+	for _, m := range migrations {
+		names = append(names, m.Name)
+	}
+
+	return names
+}
+
+func openDB(t *testing.T, queries ...string) *sql.DB {
+	db, err := sql.Open("sqlite3", "test.db")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		db.Close()
+		os.Remove("test.db")
+	})
+
+	for _, query := range queries {
+		if _, err := db.Exec(query); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return db
+}
+
+// Convert() should pair golang-migrate up and down files and order them numerically
+func TestConvertGolangMigrate(t *testing.T) {
+	source := fstest.MapFS{
+		"10_add_email.up.sql":     {Data: []byte("ALTER TABLE users ADD email TEXT;")},
+		"2_create_users.up.sql":   {Data: []byte("CREATE TABLE users (id INT);")},
+		"2_create_users.down.sql": {Data: []byte("DROP TABLE users;")},
+		"README.md":               {Data: []byte("")},
+	}
+
+	migrations, err := importer.Convert(importer.GolangMigrate, source)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"0000000000000000002_create_users", "0000000000000000010_add_email"}
+
+	if strings.Join(names(migrations), ",") != strings.Join(expected, ",") {
+		t.Fatalf("Expected %v, got %v", expected, names(migrations))
+	}
+
+	if string(migrations[0].Down) != "DROP TABLE users;" || migrations[1].Down != nil {
+		t.Fatalf("Expected only the first migration to have a rollback, got %q and %q", migrations[0].Down, migrations[1].Down)
+	}
+}
+
+// Convert() should split goose annotations into up and down scripts
+func TestConvertGoose(t *testing.T) {
+	source := fstest.MapFS{
+		"00001_create_users.sql": {Data: []byte(`-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE users (id INT);
+-- +goose StatementEnd
+
+-- +goose Down
+DROP TABLE users;
+`)},
+		"00002_index.sql": {Data: []byte("-- +goose NO TRANSACTION\n-- +goose Up\nCREATE INDEX CONCURRENTLY i ON users (id);\n")},
+	}
+
+	migrations, err := importer.Convert(importer.Goose, source)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(migrations) != 2 || migrations[0].Version != "1" || migrations[1].Version != "2" {
+		t.Fatalf("Expected versions 1 and 2, got %v", migrations)
+	}
+
+	expectedUp := "DELIMITER //\nCREATE TABLE users (id INT);\n//\nDELIMITER ;\n"
+
+	if string(migrations[0].Up) != expectedUp {
+		t.Fatalf("Expected up script %q, got %q", expectedUp, migrations[0].Up)
+	}
+
+	if string(migrations[0].Down) != "DROP TABLE users;\n" {
+		t.Fatalf("Expected down script, got %q", migrations[0].Down)
+	}
+
+	if !strings.HasPrefix(string(migrations[1].Up), migrate.NoTransactionDirective) || migrations[1].Down != nil {
+		t.Fatalf("Expected no-transaction up script without a rollback, got %q and %q", migrations[1].Up, migrations[1].Down)
+	}
+
+	source["00003_backfill.go"] = &fstest.MapFile{Data: []byte("package migrations")}
+
+	_, err = importer.Convert(importer.Goose, source)
+
+	if err == nil {
+		t.Fatal("Expected error for Go migration, got nil")
+	}
+}
+
+// Convert() should split dbmate sections into up and down scripts
+func TestConvertDbmate(t *testing.T) {
+	source := fstest.MapFS{
+		"20230101120000_create_users.sql": {Data: []byte("-- migrate:up transaction:false\nCREATE TABLE users (id INT);\n\n-- migrate:down\nDROP TABLE users;\n")},
+	}
+
+	migrations, err := importer.Convert(importer.Dbmate, source)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(migrations) != 1 || migrations[0].Name != "0000020230101120000_create_users" {
+		t.Fatalf("Expected 0000020230101120000_create_users, got %v", names(migrations))
+	}
+
+	if string(migrations[0].Up) != migrate.NoTransactionDirective+"\nCREATE TABLE users (id INT);\n" {
+		t.Fatalf("Expected no-transaction up script, got %q", migrations[0].Up)
+	}
+
+	if string(migrations[0].Down) != "DROP TABLE users;\n" {
+		t.Fatalf("Expected down script, got %q", migrations[0].Down)
+	}
+}
+
+// Convert() should order Flyway versions numerically and pair undo scripts
+func TestConvertFlyway(t *testing.T) {
+	source := fstest.MapFS{
+		"V1__Create_users.sql":   {Data: []byte("CREATE TABLE users (id INT);")},
+		"U1__Create_users.sql":   {Data: []byte("DROP TABLE users;")},
+		"V1_10__Add_email.sql":   {Data: []byte("ALTER TABLE users ADD email TEXT;")},
+		"V1.2__Add_name.sql":     {Data: []byte("ALTER TABLE users ADD name TEXT;")},
+		"V2__Create_posts.sql":   {Data: []byte("CREATE TABLE posts (id INT);")},
+		"flyway.conf":            {Data: []byte("")},
+		"V3__Create_comment.txt": {Data: []byte("")},
+	}
+
+	migrations, err := importer.Convert(importer.Flyway, source)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"0000000000000000001_Create_users",
+		"0000000000000000002_Add_name",
+		"0000000000000000003_Add_email",
+		"0000000000000000004_Create_posts",
+	}
+
+	if strings.Join(names(migrations), ",") != strings.Join(expected, ",") {
+		t.Fatalf("Expected %v, got %v", expected, names(migrations))
+	}
+
+	if migrations[2].Version != "1.10" || string(migrations[0].Down) != "DROP TABLE users;" {
+		t.Fatalf("Expected version 1.10 and an undo script for version 1, got %v", migrations)
+	}
+}
+
+// Write() should create the scripts without overwriting existing files
+func TestWriteCreatesScripts(t *testing.T) {
+	defer os.RemoveAll(MIGRATION_DIR)
+
+	migrations := []importer.Migration{
+		{Version: "1", Name: "0000000000000000001_a", Up: []byte("SELECT 1;"), Down: []byte("SELECT 2;")},
+		{Version: "2", Name: "0000000000000000002_b", Up: []byte("SELECT 3;")},
+	}
+
+	created, err := importer.Write(MIGRATION_DIR, migrations)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "0000000000000000001_a_up.sql,0000000000000000001_a_down.sql,0000000000000000002_b_up.sql"
+
+	if strings.Join(created, ",") != expected {
+		t.Fatalf("Expected %s, got %v", expected, created)
+	}
+
+	content, _ := os.ReadFile(filepath.Join(MIGRATION_DIR, "0000000000000000001_a_down.sql"))
+
+	if string(content) != "SELECT 2;" {
+		t.Fatalf("Expected down script to be written, got %q", content)
+	}
+
+	_, err = importer.Write(MIGRATION_DIR, migrations)
+
+	if err == nil {
+		t.Fatal("Expected error when files already exist, got nil")
+	}
+}
+
+// Applied() should return the versions applied by golang-migrate
+func TestAppliedGolangMigrate(t *testing.T) {
+	migrations := []importer.Migration{{Version: "1", Name: "a"}, {Version: "2", Name: "b"}, {Version: "3", Name: "c"}}
+
+	db := openDB(t,
+		"CREATE TABLE schema_migrations (version BIGINT NOT NULL PRIMARY KEY, dirty BOOLEAN NOT NULL)",
+		"INSERT INTO schema_migrations VALUES (2, false)",
+	)
+
+	applied, err := importer.Applied(context.Background(), importer.GolangMigrate, db, "", migrations)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Join(names(applied), ",") != "a,b" {
+		t.Fatalf("Expected a and b to be applied, got %v", names(applied))
+	}
+
+	db.Exec("UPDATE schema_migrations SET dirty = true")
+
+	_, err = importer.Applied(context.Background(), importer.GolangMigrate, db, "", migrations)
+
+	if err == nil {
+		t.Fatal("Expected error for dirty database, got nil")
+	}
+}
+
+// Applied() should use the most recent goose row for each version
+func TestAppliedGoose(t *testing.T) {
+	migrations := []importer.Migration{{Version: "1", Name: "a"}, {Version: "2", Name: "b"}}
+
+	db := openDB(t,
+		"CREATE TABLE goose_db_version (id INTEGER PRIMARY KEY AUTOINCREMENT, version_id INTEGER NOT NULL, is_applied INTEGER NOT NULL, tstamp TIMESTAMP DEFAULT CURRENT_TIMESTAMP)",
+		"INSERT INTO goose_db_version (version_id, is_applied) VALUES (0, 1), (1, 1), (2, 1), (2, 0)",
+	)
+
+	applied, err := importer.Applied(context.Background(), importer.Goose, db, "", migrations)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Join(names(applied), ",") != "a" {
+		t.Fatalf("Expected only a to be applied, got %v", names(applied))
+	}
+}
+
+// Applied() should return an error if an applied version has no migration
+func TestAppliedDbmateMissingMigration(t *testing.T) {
+	migrations := []importer.Migration{{Version: "20230101120000", Name: "a"}}
+
+	db := openDB(t,
+		"CREATE TABLE schema_migrations (version VARCHAR(128) PRIMARY KEY)",
+		"INSERT INTO schema_migrations VALUES ('20230101120000')",
+	)
+
+	applied, err := importer.Applied(context.Background(), importer.Dbmate, db, "", migrations)
+
+	if err != nil || len(applied) != 1 {
+		t.Fatalf("Expected a to be applied, got %v (%v)", names(applied), err)
+	}
+
+	db.Exec("INSERT INTO schema_migrations VALUES ('20230102120000')")
+
+	_, err = importer.Applied(context.Background(), importer.Dbmate, db, "", migrations)
+
+	if err == nil {
+		t.Fatal("Expected error for missing migration, got nil")
+	}
+}
+
+// Applied() should handle Flyway baselines and undo scripts
+func TestAppliedFlyway(t *testing.T) {
+	migrations := []importer.Migration{{Version: "1", Name: "a"}, {Version: "1.1", Name: "b"}, {Version: "2", Name: "c"}, {Version: "3", Name: "d"}}
+
+	db := openDB(t,
+		`CREATE TABLE flyway_schema_history (installed_rank INT PRIMARY KEY, version VARCHAR(50), description VARCHAR(200),
+			type VARCHAR(20), script VARCHAR(1000), success BOOLEAN)`,
+		`INSERT INTO flyway_schema_history VALUES
+			(1, '1.1', '<< Flyway Baseline >>', 'BASELINE', '', true),
+			(2, '2', 'Create', 'SQL', 'V2__Create.sql', true),
+			(3, '3', 'Failed', 'SQL', 'V3__Failed.sql', false),
+			(4, NULL, 'Repeatable', 'SQL', 'R__Repeatable.sql', true)`,
+	)
+
+	applied, err := importer.Applied(context.Background(), importer.Flyway, db, "", migrations)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Join(names(applied), ",") != "a,b,c" {
+		t.Fatalf("Expected a, b and c to be applied, got %v", names(applied))
+	}
+}
+
+// Seed() should add the applied migrations to the log in a single step
+func TestSeedAddsMigrationsToLog(t *testing.T) {
+	// The lock and dirty files are created alongside the log
+	log, err := migrate.NewLogFile(filepath.Join(t.TempDir(), "test.log"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log.Add(migrate.Migration{Name: "0000000000000000001_a", Step: 1})
+
+	added, err := importer.Seed(&log, []importer.Migration{
+		{Version: "1", Name: "0000000000000000001_a"},
+		{Version: "2", Name: "0000000000000000002_b"},
+		{Version: "3", Name: "0000000000000000003_c"},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(added) != 2 || len(log.Migrations) != 3 {
+		t.Fatalf("Expected 2 migrations to be added, got %v", log.Migrations)
+	}
+
+	for _, m := range added {
+		if m.Step != 2 {
+			t.Fatalf("Expected migrations to be added in step 2, got %v", added)
+		}
+	}
+}
+
+// Seed() should refuse to add migrations while the log is dirty
+func TestSeedReturnsErrorIfLogDirty(t *testing.T) {
+	// The lock and dirty files are created alongside the log
+	log, err := migrate.NewLogFile(filepath.Join(t.TempDir(), "test.log"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = log.SetDirty(context.Background(), migrate.DirtyMigration{Name: "0000000000000000001_a", Direction: migrate.DirectionUp, Step: 1})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	added, err := importer.Seed(&log, []importer.Migration{{Version: "1", Name: "0000000000000000001_a"}})
+
+	if !errors.Is(err, migrate.ErrDirty) {
+		t.Fatalf("Expected ErrDirty, got %v", err)
+	}
+
+	if len(added) != 0 || log.Contains("0000000000000000001_a") {
+		t.Fatalf("Expected the log to be unchanged, found %v", log.Migrations)
+	}
+}
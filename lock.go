@@ -0,0 +1,139 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Returned when a lock could not be acquired before the timeout expired
+var ErrLockTimeout = errors.New("timed out waiting for migration lock")
+
+// Returned by ForceUnlock if the lock of the log is released when the process holding it exits
+var ErrForceUnlockUnsupported = errors.New("the lock is released when the process holding it exits")
+
+// Time to wait for a lock if the log doesn't specify a timeout
+const DefaultLockTimeout = 30 * time.Second
+
+// Interval between attempts to acquire a lock for logs that need to poll
+const lockPollInterval = 100 * time.Millisecond
+
+/*
+Optional extension of MigrationLog which prevents migrations from being run
+concurrently, for example, when several replicas of a service start at the same
+time and each call Migrate.
+
+If the log implements Locker, Migrate, Rollback (and their variants) acquire the
+lock before reading the log and release it once they have finished. Lock should
+wait until the lock is available, returning ErrLockTimeout if it cannot be
+acquired within the log's timeout (or ctx is cancelled).
+
+The package includes implementations for each of the log drivers:
+
+  - MySQL uses GET_LOCK/RELEASE_LOCK
+  - PostgreSQL uses a session level advisory lock
+  - SQL Server uses sp_getapplock/sp_releaseapplock
+  - SQLite uses a lock table
+  - File uses a lock file alongside the log file
+*/
+type Locker interface {
+	Lock(ctx context.Context) error
+	Unlock(ctx context.Context) error
+}
+
+/*
+Optional extension of Locker for logs whose lock isn't released if the process
+holding it is killed (e.g. the lock table of LogSQLite), ForceUnlock releases
+the lock whoever holds it. ErrForceUnlockUnsupported should be returned if the
+lock doesn't need to be released.
+*/
+type ForceUnlocker interface {
+	ForceUnlock(ctx context.Context) error
+}
+
+/*
+ForceUnlock releases the lock left behind by a process which was killed while
+holding it, after which Migrate, Rollback etc. stop returning ErrLockTimeout. It
+should only be used once it's certain no other process is running migrations,
+otherwise they could run concurrently.
+
+ErrForceUnlockUnsupported is returned if the log's lock is released
+automatically (or the log doesn't implement ForceUnlocker).
+*/
+func ForceUnlock(log MigrationLog) error {
+	return ForceUnlockContext(context.Background(), log)
+}
+
+// ForceUnlockContext is the same as ForceUnlock but accepts a context.
+func ForceUnlockContext(ctx context.Context, log MigrationLog) error {
+	unlocker, ok := log.(ForceUnlocker)
+
+	if !ok {
+		return fmt.Errorf("ForceUnlock: %w", ErrForceUnlockUnsupported)
+	}
+
+	if err := unlocker.ForceUnlock(ctx); err != nil {
+		return fmt.Errorf("ForceUnlock: %w", err)
+	}
+
+	return nil
+}
+
+// Runs fn while holding the log's lock (if the log implements Locker)
+func withLock(ctx context.Context, log MigrationLog, fn func() error) error {
+	locker, ok := log.(Locker)
+
+	if !ok {
+		return fn()
+	}
+
+	if err := locker.Lock(ctx); err != nil {
+		return fmt.Errorf("unable to acquire lock: %w", err)
+	}
+
+	err := fn()
+
+	// Release the lock even if the context has been cancelled
+	if unlockErr := locker.Unlock(context.WithoutCancel(ctx)); unlockErr != nil {
+		return errors.Join(err, fmt.Errorf("unable to release lock: %w", unlockErr))
+	}
+
+	return err
+}
+
+// Returns the timeout or the default if no timeout is set
+func lockTimeout(timeout time.Duration) time.Duration {
+	if timeout <= 0 {
+		return DefaultLockTimeout
+	}
+
+	return timeout
+}
+
+// Calls acquire until it succeeds, returns an error or the timeout expires
+func pollLock(ctx context.Context, timeout time.Duration, acquire func() (bool, error)) error {
+	deadline := time.Now().Add(lockTimeout(timeout))
+
+	for {
+		acquired, err := acquire()
+
+		if err != nil {
+			return err
+		}
+
+		if acquired {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return ErrLockTimeout
+		}
+
+		select {
+		case <-ctx.Done():
+			return errors.Join(ErrLockTimeout, ctx.Err())
+		case <-time.After(lockPollInterval):
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package migrate
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+/*
+LogEncoding converts the migrations of a LogFile to and from the content of the
+log file. The package includes CSVEncoding (the default), JSONLinesEncoding and
+YAMLEncoding, the encoding is selected with the WithEncoding option or from the
+extension of the log file.
+
+Encode should return content ending with a line break, a file which doesn't is
+rejected when loaded as it was only partially written.
+*/
+type LogEncoding interface {
+	Encode(migrations []Migration) ([]byte, error)
+	Decode(content []byte) ([]Migration, error)
+}
+
+/*
+WithEncoding sets the encoding of the log file (see LogEncoding), by default
+the encoding is chosen from the extension of the file (`.jsonl` for JSON Lines,
+`.yaml`/`.yml` for YAML, CSV otherwise) or, if the file isn't empty, detected
+from its content.
+*/
+func WithEncoding(encoding LogEncoding) LogOption {
+	return func(o *logOptions) {
+		o.encoding = encoding
+	}
+}
+
+/*
+CSVEncoding writes a line per migration, `step,name[,checksum]` optionally
+followed by the metadata `,applied at,duration (ms),executor,label`. This is
+the format written by earlier versions, names containing a comma or line break
+can't be encoded.
+*/
+type CSVEncoding struct{}
+
+func (CSVEncoding) Encode(migrations []Migration) ([]byte, error) {
+	var content bytes.Buffer
+
+	for _, m := range migrations {
+		if strings.ContainsAny(m.Name, ",\r\n") {
+			return nil, fmt.Errorf("migration name '%s' can't be stored in a CSV log, use the JSON Lines or YAML encoding", m.Name)
+		}
+
+		content.WriteString(m.string() + "\n")
+	}
+
+	return content.Bytes(), nil
+}
+
+func (CSVEncoding) Decode(content []byte) ([]Migration, error) {
+	var migrations []Migration
+
+	for _, line := range splitLines(content) {
+		migration, err := parseLogLine(line)
+
+		if err != nil {
+			return nil, err
+		}
+
+		migrations = append(migrations, migration)
+	}
+
+	return migrations, nil
+}
+
+// Fields of a migration written by the JSON Lines and YAML encodings
+type migrationRecord struct {
+	Name       string `json:"name" yaml:"name"`
+	Step       int    `json:"step" yaml:"step"`
+	Checksum   string `json:"checksum,omitempty" yaml:"checksum,omitempty"`
+	AppliedAt  string `json:"applied_at,omitempty" yaml:"applied_at,omitempty"`
+	DurationMs int64  `json:"duration_ms,omitempty" yaml:"duration_ms,omitempty"`
+	Executor   string `json:"executor,omitempty" yaml:"executor,omitempty"`
+	Label      string `json:"label,omitempty" yaml:"label,omitempty"`
+}
+
+func newMigrationRecord(m Migration) migrationRecord {
+	return migrationRecord{
+		Name:       m.Name,
+		Step:       m.Step,
+		Checksum:   m.Checksum,
+		AppliedAt:  formatAppliedAt(m.AppliedAt),
+		DurationMs: m.Duration.Milliseconds(),
+		Executor:   m.Executor,
+		Label:      m.Label,
+	}
+}
+
+func (r migrationRecord) migration() (Migration, error) {
+	appliedAt, err := parseAppliedAt(r.AppliedAt)
+
+	if err != nil {
+		return Migration{}, err
+	}
+
+	return Migration{
+		Name:      r.Name,
+		Step:      r.Step,
+		Checksum:  r.Checksum,
+		AppliedAt: appliedAt,
+		Duration:  time.Duration(r.DurationMs) * time.Millisecond,
+		Executor:  r.Executor,
+		Label:     r.Label,
+	}, nil
+}
+
+/*
+JSONLinesEncoding writes a JSON object per line, e.g.
+`{"name":"123_create_table","step":1,"checksum":"..."}`, empty fields are omitted.
+*/
+type JSONLinesEncoding struct{}
+
+func (JSONLinesEncoding) Encode(migrations []Migration) ([]byte, error) {
+	var content bytes.Buffer
+
+	encoder := json.NewEncoder(&content)
+
+	for _, m := range migrations {
+		// Encode terminates each object with a line break
+		if err := encoder.Encode(newMigrationRecord(m)); err != nil {
+			return nil, err
+		}
+	}
+
+	return content.Bytes(), nil
+}
+
+func (JSONLinesEncoding) Decode(content []byte) ([]Migration, error) {
+	var migrations []Migration
+
+	for _, line := range splitLines(content) {
+		var record migrationRecord
+
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			return nil, errors.New("log line malformed: " + err.Error())
+		}
+
+		migration, err := record.migration()
+
+		if err != nil {
+			return nil, errors.New("log line " + err.Error())
+		}
+
+		migrations = append(migrations, migration)
+	}
+
+	return migrations, nil
+}
+
+// YAMLEncoding writes a YAML document (separated by `---`) per migration, empty fields are omitted.
+type YAMLEncoding struct{}
+
+func (YAMLEncoding) Encode(migrations []Migration) ([]byte, error) {
+	var content bytes.Buffer
+
+	encoder := yaml.NewEncoder(&content)
+	encoder.SetIndent(2)
+
+	for _, m := range migrations {
+		if err := encoder.Encode(newMigrationRecord(m)); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+
+	return content.Bytes(), nil
+}
+
+func (YAMLEncoding) Decode(content []byte) ([]Migration, error) {
+	var migrations []Migration
+
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+
+	for {
+		var record migrationRecord
+
+		err := decoder.Decode(&record)
+
+		if errors.Is(err, io.EOF) {
+			return migrations, nil
+		}
+
+		if err != nil {
+			return nil, errors.New("log document malformed: " + err.Error())
+		}
+
+		migration, err := record.migration()
+
+		if err != nil {
+			return nil, errors.New("log document " + err.Error())
+		}
+
+		migrations = append(migrations, migration)
+	}
+}
+
+// Returns the encoding of the log file based on its extension
+func encodingForPath(path string) LogEncoding {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jsonl", ".ndjson":
+		return JSONLinesEncoding{}
+	case ".yaml", ".yml":
+		return YAMLEncoding{}
+	}
+
+	return CSVEncoding{}
+}
+
+/*
+Detects the encoding of the (non-empty) content of an existing log file, JSON
+Lines start with an object, YAML with a document marker or a `key:` mapping and
+CSV with the step.
+*/
+func detectEncoding(content []byte) LogEncoding {
+	trimmed := bytes.TrimSpace(content)
+
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("{")):
+		return JSONLinesEncoding{}
+	case bytes.HasPrefix(trimmed, []byte("---")), bytes.HasPrefix(trimmed, []byte("#")):
+		return YAMLEncoding{}
+	}
+
+	firstLine, _, _ := strings.Cut(string(trimmed), "\n")
+
+	if key, _, found := strings.Cut(firstLine, ":"); found && !strings.Contains(key, ",") {
+		return YAMLEncoding{}
+	}
+
+	return CSVEncoding{}
+}
+
+// Splits content into lines, ignoring the line break terminating the last line
+func splitLines(content []byte) []string {
+	if len(content) == 0 {
+		return nil
+	}
+
+	return strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+}
@@ -4,22 +4,17 @@ Lightweight, DB agnostic migration tool.
 package migrate
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"io/fs"
 	"regexp"
 	"sort"
+	"strings"
+	"time"
 )
 
-type ErrorQuery struct {
-	queryError error
-	fileName   string
-}
-
-func (e ErrorQuery) Error() string {
-	return "error executing query in " + e.fileName + ": " + e.queryError.Error()
-}
-
 /*
 Migrate executes all migrations that haven't previously run.
 
@@ -36,20 +31,239 @@ even if there is a rollback script `_up` is not required (but maybe useful for c
 
 Migrations are executed in ascending order.
 
-If a rollback fails to run, an `ErrorQuery` error is returned.
+Each migration is executed in its own transaction which is rolled back if the
+script fails. If the log is stored in the same database (and implements
+MigrationLogTx) the log entry is written in the same transaction. Scripts that
+cannot run within a transaction can opt out by including the
+`-- migrate:no-transaction` directive on its own line.
+
+Transactions only make migrations atomic where the database supports
+transactional DDL, MySQL implicitly commits DDL statements so if a later
+statement in the script fails the earlier ones aren't rolled back and the
+schema is left half applied.
+
+If the log implements Locker the lock is held for the duration of the call,
+preventing concurrent calls (e.g. from other replicas) running the same migrations.
+
+If a migration fails to run, an `ErrorQuery` error is returned.
 */
 func Migrate(driver *sql.DB, directory fs.FS, log MigrationLog) error {
+	return MigrateContext(context.Background(), driver, directory, log)
+}
+
+/*
+MigrateContext is the same as Migrate but accepts a context, the context is used
+for all queries and (if the log implements MigrationLogContext) all log operations.
+If the context is cancelled the current migration is rolled back and the context
+error is returned.
+*/
+func MigrateContext(ctx context.Context, driver *sql.DB, directory fs.FS, log MigrationLog) error {
+	return withLock(ctx, log, func() error {
+		migrations, err := pendingMigrations(ctx, directory, log)
+
+		if err != nil {
+			return fmt.Errorf("Migrate: unable to retrieve migration files: %w", err)
+		}
+
+		return runMigrations(ctx, driver, directory, log, migrations)
+	})
+}
+
+/*
+MigrateTo executes the pending migrations in order up to and including the
+`target` migration, all executed migrations are added to the log in a single
+step (in the same way as Migrate).
+
+The target can either be the full name of the migration (e.g. `123_create_table`),
+its file name or just its prefix (e.g. `123`). If the target has already been
+applied but earlier migrations are pending, the earlier migrations are executed.
+ErrMigrationNotFound is returned if no migration matches the target.
+*/
+func MigrateTo(driver *sql.DB, directory fs.FS, log MigrationLog, target string) error {
+	return MigrateToContext(context.Background(), driver, directory, log, target)
+}
+
+// MigrateToContext is the same as MigrateTo but accepts a context.
+func MigrateToContext(ctx context.Context, driver *sql.DB, directory fs.FS, log MigrationLog, target string) error {
+	return withLock(ctx, log, func() error {
+		migrations, err := pendingMigrationsTo(ctx, directory, log, target)
+
+		if err != nil {
+			return fmt.Errorf("MigrateTo: %w", err)
+		}
+
+		return runMigrations(ctx, driver, directory, log, migrations)
+	})
+}
+
+/*
+MigrateN executes the next `n` pending migrations in order, all executed
+migrations are added to the log in a single step (in the same way as Migrate).
+*/
+func MigrateN(driver *sql.DB, directory fs.FS, log MigrationLog, n int) error {
+	return MigrateNContext(context.Background(), driver, directory, log, n)
+}
+
+// MigrateNContext is the same as MigrateN but accepts a context.
+func MigrateNContext(ctx context.Context, driver *sql.DB, directory fs.FS, log MigrationLog, n int) error {
+	return withLock(ctx, log, func() error {
+		migrations, err := pendingMigrationsN(ctx, directory, log, n)
+
+		if err != nil {
+			return fmt.Errorf("MigrateN: %w", err)
+		}
+
+		return runMigrations(ctx, driver, directory, log, migrations)
+	})
+}
+
+// Executes the migrations in order, adding them to the log in a new step
+func runMigrations(ctx context.Context, driver *sql.DB, directory fs.FS, log MigrationLog, migrations []migrationFile) error {
+	if err := checkClean(ctx, log); err != nil {
+		return fmt.Errorf("Migrate: %w", err)
+	}
+
+	step := logLastStep(ctx, log) + 1
+
+	for _, pending := range migrations {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		up, err := upScript(directory, pending)
+
+		if err != nil {
+			return fmt.Errorf("Migrate: unable to read migration '%s': %w", pending.file, err)
+		}
+
+		m := Migration{
+			Name:     pending.name,
+			Step:     step,
+			Checksum: up.checksum,
+		}
+
+		err = logSetDirty(ctx, log, m.Name, DirectionUp, step)
+
+		if err != nil {
+			return fmt.Errorf("Migrate: unable to mark migration '%s' as started: %w", up.source, err)
+		}
+
+		start := time.Now()
+		rolledBack, err := applyMigration(ctx, driver, log, up, m)
+
+		// The database is unchanged if the transaction was rolled back
+		if err == nil || rolledBack {
+			if clearErr := logClearDirty(ctx, log); clearErr != nil {
+				return errors.Join(err, fmt.Errorf("Migrate: unable to clear dirty state: %w", clearErr))
+			}
+		}
+
+		if historyErr := logHistory(ctx, log, m, DirectionUp, start, err); historyErr != nil {
+			return errors.Join(err, fmt.Errorf("Migrate: unable to record history: %w", historyErr))
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/*
+Runs the migration script and adds it to the log, returns true if the script
+failed within a transaction (and was therefore rolled back).
+*/
+func applyMigration(ctx context.Context, driver *sql.DB, log MigrationLog, up script, m Migration) (bool, error) {
+	migration := up.source
+	start := time.Now()
+
+	if !up.transaction {
+		err := up.run(ctx, driver)
+
+		if err != nil {
+			return false, newErrorQuery(up, DirectionUp, m.Step, err)
+		}
+
+		stampMigration(ctx, &m, time.Now(), time.Since(start))
+
+		err = logAdd(ctx, log, m)
+
+		if err != nil {
+			return false, fmt.Errorf("Migrate: unable to add migration '%s' to log: %w", migration, err)
+		}
+
+		return false, nil
+	}
+
+	tx, err := driver.BeginTx(ctx, nil)
+
+	if err != nil {
+		return true, fmt.Errorf("Migrate: unable to start transaction for '%s': %w", migration, err)
+	}
+
+	err = runTx(ctx, tx, up)
+
+	if err != nil {
+		return true, newErrorQuery(up, DirectionUp, m.Step, err)
+	}
+
+	stampMigration(ctx, &m, time.Now(), time.Since(start))
+
+	// Write to the log in the same transaction if possible
+	if txLog, ok := transactionalLog(driver, log); ok {
+		err = txLog.AddTx(ctx, tx, m)
+
+		if err != nil {
+			tx.Rollback()
+
+			return true, fmt.Errorf("Migrate: unable to add migration '%s' to log: %w", migration, err)
+		}
+
+		err = tx.Commit()
+
+		if err != nil {
+			return true, fmt.Errorf("Migrate: unable to commit migration '%s': %w", migration, err)
+		}
+
+		return false, nil
+	}
+
+	err = tx.Commit()
+
+	if err != nil {
+		return true, fmt.Errorf("Migrate: unable to commit migration '%s': %w", migration, err)
+	}
+
+	err = logAdd(ctx, log, m)
+
+	if err != nil {
+		return false, fmt.Errorf("Migrate: unable to add migration '%s' to log: %w", migration, err)
+	}
+
+	return false, nil
+}
+
+// A migration script (or Go migration, in which case file is empty)
+type migrationFile struct {
+	name string
+	file string
+}
+
+// Returns all migrations (excluding rollbacks) in the directory, in order of execution
+func migrationFiles(directory fs.FS) ([]migrationFile, error) {
 	migrations, err := fs.Glob(directory, `*.sql`)
 
 	if err != nil {
-		return fmt.Errorf("Migrate: unable to retrieve migration files: %v", err)
+		return nil, err
 	}
 
 	// ensure migrations are ordered
 	sort.Strings(migrations)
 
 	nameRegexp := regexp.MustCompile(`(.*?)(_up|_down)?\.sql`)
-	step := log.LastStep() + 1
+
+	var files []migrationFile
 
 	for _, migration := range migrations {
 		nameParts := nameRegexp.FindStringSubmatch(migration)
@@ -59,35 +273,114 @@ func Migrate(driver *sql.DB, directory fs.FS, log MigrationLog) error {
 			continue
 		}
 
+		files = append(files, migrationFile{
+			name: nameParts[1],
+			file: migration,
+		})
+	}
+
+	registry, ok := directory.(*Registry)
+
+	if !ok || len(registry.migrations) == 0 {
+		return files, nil
+	}
+
+	for _, file := range files {
+		if _, exists := registry.migrations[file.name]; exists {
+			return nil, fmt.Errorf("migration '%s' exists as both a script and a Go migration", file.name)
+		}
+	}
+
+	for name := range registry.migrations {
+		files = append(files, migrationFile{
+			name: name,
+		})
+	}
+
+	// Scripts are ordered by file name, Go migrations by name
+	sort.SliceStable(files, func(i, j int) bool {
+		return files[i].key() < files[j].key()
+	})
+
+	return files, nil
+}
+
+func (f migrationFile) key() string {
+	if f.file == "" {
+		return f.name
+	}
+
+	return f.file
+}
+
+// Returns the migrations in the directory which haven't been applied, in order of execution
+func pendingMigrations(ctx context.Context, directory fs.FS, log MigrationLog) ([]migrationFile, error) {
+	migrations, err := migrationFiles(directory)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []migrationFile
+
+	for _, migration := range migrations {
 		// Ignore any migrations that have already run
-		if log.Contains(nameParts[1]) {
+		if logContains(ctx, log, migration.name) {
 			continue
 		}
 
-		query, err := fs.ReadFile(directory, migration)
+		pending = append(pending, migration)
+	}
 
-		if err != nil {
-			return fmt.Errorf("Migrate: unable to read migration '%s': %v", migration, err)
-		}
+	return pending, nil
+}
 
-		_, err = driver.Exec(string(query))
+// Returns the pending migrations up to and including the target migration
+func pendingMigrationsTo(ctx context.Context, directory fs.FS, log MigrationLog, target string) ([]migrationFile, error) {
+	files, err := migrationFiles(directory)
 
-		if err != nil {
-			return ErrorQuery{
-				queryError: err,
-				fileName:   migration,
-			}
-		}
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve migration files: %w", err)
+	}
 
-		err = log.Add(Migration{
-			Name: nameParts[1],
-			Step: step,
-		})
+	targetKey := ""
 
-		if err != nil {
-			return fmt.Errorf("Migrate: unable to add migration '%s' to log: %v", migration, err)
+	for _, file := range files {
+		if file.name == target || file.file == target || strings.HasPrefix(file.name, target+"_") {
+			targetKey = file.key()
 		}
 	}
 
-	return nil
+	if targetKey == "" {
+		return nil, fmt.Errorf("%w: '%s'", ErrMigrationNotFound, target)
+	}
+
+	pending, err := pendingMigrations(ctx, directory, log)
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve migration files: %w", err)
+	}
+
+	end := 0
+
+	for end < len(pending) && pending[end].key() <= targetKey {
+		end++
+	}
+
+	return pending[:end], nil
+}
+
+// Returns the next n pending migrations
+func pendingMigrationsN(ctx context.Context, directory fs.FS, log MigrationLog, n int) ([]migrationFile, error) {
+	if n < 1 {
+		return nil, fmt.Errorf("number of migrations must be at least 1, got %d", n)
+	}
+
+	pending, err := pendingMigrations(ctx, directory, log)
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve migration files: %w", err)
+	}
+
+	return pending[:min(n, len(pending))], nil
 }
@@ -1,13 +1,17 @@
 package migrate_test
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"os"
 	"strings"
 	"testing"
 	"testing/fstest"
+	"time"
 
 	"github.com/jameswhoughton/migrate"
+	"github.com/mattn/go-sqlite3"
 )
 
 // Migrate() should return error if the query fails to execute
@@ -113,3 +117,326 @@ func TestUpSuffixIsOptional(t *testing.T) {
 		t.Fatalf("Expected 1 migration to run, %d ran", len(log.store))
 	}
 }
+
+// Migrate() should roll back a partially applied script if a statement fails
+func TestMigrateRollsBackFailedScript(t *testing.T) {
+	db, _ := sql.Open("sqlite3", "test.db")
+	defer os.Remove("test.db")
+
+	log, err := migrate.NewLogSQLite(db)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testFs := fstest.MapFS{
+		"1_migration_up.sql": {Data: []byte("CREATE TABLE users (ID INT PRIMARY KEY, name VARCHAR(100)); I am not a valid query;")},
+	}
+
+	err = migrate.Migrate(db, testFs, &log)
+
+	if err == nil {
+		t.Fatal("Expected error, got nil")
+	}
+
+	var count int
+
+	db.QueryRow("SELECT COUNT(*) FROM sqlite_schema WHERE type='table' AND name='users';").Scan(&count)
+
+	if count != 0 {
+		t.Error("Expected users table to be rolled back")
+	}
+
+	if log.Contains("1_migration") {
+		t.Error("Expected failed migration to be absent from the log")
+	}
+}
+
+// Migrate() should not use a transaction if the script contains the no-transaction directive
+func TestMigrateNoTransactionDirective(t *testing.T) {
+	db, _ := sql.Open("sqlite3", "test.db")
+	defer os.Remove("test.db")
+
+	log := newTestLog()
+
+	testFs := fstest.MapFS{
+		"1_migration_up.sql": {Data: []byte(migrate.NoTransactionDirective + "\nCREATE TABLE users (ID INT PRIMARY KEY, name VARCHAR(100)); I am not a valid query;")},
+	}
+
+	err := migrate.Migrate(db, testFs, &log)
+
+	if err == nil {
+		t.Fatal("Expected error, got nil")
+	}
+
+	var count int
+
+	db.QueryRow("SELECT COUNT(*) FROM sqlite_schema WHERE type='table' AND name='users';").Scan(&count)
+
+	if count != 1 {
+		t.Error("Expected users table to exist")
+	}
+}
+
+// MigrateContext() should not run any migrations if the context is cancelled
+func TestMigrateContextStopsWhenContextCancelled(t *testing.T) {
+	db, _ := sql.Open("sqlite3", "test.db")
+	defer os.Remove("test.db")
+
+	log := newTestLog()
+
+	testFs := fstest.MapFS{
+		"1_migration_up.sql": {Data: []byte("CREATE TABLE users (ID INT PRIMARY KEY, name VARCHAR(100))")},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := migrate.MigrateContext(ctx, db, testFs, &log)
+
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+
+	if len(log.store) != 0 {
+		t.Fatalf("Expected 0 migrations to run, %d ran", len(log.store))
+	}
+}
+
+// MigrateTo() runs pending migrations up to and including the target in a single step
+func TestMigrateToRunsMigrationsUpToTarget(t *testing.T) {
+	db, _ := sql.Open("sqlite3", "test.db")
+	defer os.Remove("test.db")
+
+	log := newTestLog()
+
+	testFs := fstest.MapFS{
+		"1_migrationA_up.sql": {Data: []byte("")},
+		"2_migrationB_up.sql": {Data: []byte("")},
+		"3_migrationC_up.sql": {Data: []byte("")},
+	}
+
+	err := migrate.MigrateTo(db, testFs, &log, "2")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(log.store) != 2 || log.store[1].Name != "2_migrationB" {
+		t.Fatalf("Expected 2 migrations ending with 2_migrationB, found %v", log.store)
+	}
+
+	if log.store[0].Step != 1 || log.store[1].Step != 1 {
+		t.Errorf("Expected both migrations to have step 1, found %v", log.store)
+	}
+
+	err = migrate.MigrateTo(db, testFs, &log, "3_migrationC")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(log.store) != 3 || log.store[2].Step != 2 {
+		t.Fatalf("Expected 3_migrationC to run in step 2, found %v", log.store)
+	}
+}
+
+// MigrateTo() returns an error if the target doesn't exist
+func TestMigrateToReturnsErrorIfTargetMissing(t *testing.T) {
+	db, _ := sql.Open("sqlite3", "test.db")
+	defer os.Remove("test.db")
+
+	log := newTestLog()
+
+	testFs := fstest.MapFS{
+		"1_migrationA_up.sql": {Data: []byte("")},
+	}
+
+	err := migrate.MigrateTo(db, testFs, &log, "2")
+
+	if !errors.Is(err, migrate.ErrMigrationNotFound) {
+		t.Fatalf("Expected ErrMigrationNotFound, got %v", err)
+	}
+
+	if len(log.store) != 0 {
+		t.Fatalf("Expected 0 migrations to run, %d ran", len(log.store))
+	}
+}
+
+// MigrateN() runs the next n pending migrations in a single step
+func TestMigrateNRunsNextNMigrations(t *testing.T) {
+	db, _ := sql.Open("sqlite3", "test.db")
+	defer os.Remove("test.db")
+
+	log := newTestLog()
+
+	testFs := fstest.MapFS{
+		"1_migrationA_up.sql": {Data: []byte("")},
+		"2_migrationB_up.sql": {Data: []byte("")},
+		"3_migrationC_up.sql": {Data: []byte("")},
+	}
+
+	err := migrate.MigrateN(db, testFs, &log, 2)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(log.store) != 2 || log.store[1].Name != "2_migrationB" {
+		t.Fatalf("Expected 2 migrations ending with 2_migrationB, found %v", log.store)
+	}
+
+	err = migrate.MigrateN(db, testFs, &log, 2)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(log.store) != 3 || log.store[2].Step != 2 {
+		t.Fatalf("Expected 3_migrationC to run in step 2, found %v", log.store)
+	}
+}
+
+// Migrate() should not run while another process holds the lock
+func TestMigrateWaitsForLock(t *testing.T) {
+	db, _ := sql.Open("sqlite3", "test.db")
+	defer os.Remove("test.db")
+
+	log, err := migrate.NewLogSQLite(db)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := migrate.NewLogSQLite(db)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = other.Lock(context.Background())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testFs := fstest.MapFS{
+		"1_migration_up.sql": {Data: []byte("")},
+	}
+
+	log.LockTimeout = 200 * time.Millisecond
+
+	err = migrate.Migrate(db, testFs, &log)
+
+	if !errors.Is(err, migrate.ErrLockTimeout) {
+		t.Fatalf("Expected ErrLockTimeout, got %v", err)
+	}
+
+	if log.Contains("1_migration") {
+		t.Fatal("Expected migration not to run")
+	}
+
+	other.Unlock(context.Background())
+
+	err = migrate.Migrate(db, testFs, &log)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Migrate() should report the failing statement and the line on which it starts
+func TestErrorQueryIncludesStatementAndLine(t *testing.T) {
+	db, _ := sql.Open("sqlite3", "test.db")
+	defer os.Remove("test.db")
+
+	log := newTestLog()
+
+	testFs := fstest.MapFS{
+		"1_migration_up.sql": {Data: []byte("CREATE TABLE a (id INT);\n\n-- invalid\nI am not a valid query;\n")},
+	}
+
+	err := migrate.Migrate(db, testFs, &log)
+
+	if err == nil {
+		t.Fatal("Expected error, got nil")
+	}
+
+	if !strings.HasPrefix(err.Error(), "error executing statement 2 (line 4) in 1_migration_up.sql") {
+		t.Fatalf("Expected error to include the statement and line, got %s", err)
+	}
+}
+
+// Migrate() should execute scripts containing triggers with multiple statements
+func TestMigrateSplitsScriptsContainingTriggers(t *testing.T) {
+	db, _ := sql.Open("sqlite3", "test.db")
+	defer os.Remove("test.db")
+
+	log := newTestLog()
+
+	testFs := fstest.MapFS{
+		"1_migration_up.sql": {Data: []byte(`CREATE TABLE users (id INT PRIMARY KEY, name VARCHAR(100));
+CREATE TABLE audit (name VARCHAR(100));
+CREATE TRIGGER users_audit AFTER INSERT ON users
+BEGIN
+	INSERT INTO audit VALUES (NEW.name);
+	INSERT INTO audit VALUES ('a;b');
+END;
+INSERT INTO users VALUES (1, 'test');`)},
+	}
+
+	err := migrate.Migrate(db, testFs, &log)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var count int
+
+	db.QueryRow("SELECT COUNT(*) FROM audit").Scan(&count)
+
+	if count != 2 {
+		t.Fatalf("Expected 2 audit rows, got %d", count)
+	}
+}
+
+// ErrorQuery should expose the failing script and wrap the driver error
+func TestErrorQueryIsStructuredAndWrapsDriverError(t *testing.T) {
+	db, _ := sql.Open("sqlite3", "test.db")
+	defer os.Remove("test.db")
+
+	log := newTestLog()
+	log.Add(migrate.Migration{Name: "1_migrationA", Step: 1})
+
+	testFs := fstest.MapFS{
+		"1_migrationA_up.sql": {Data: []byte("")},
+		"2_migrationB_up.sql": {Data: []byte("CREATE TABLE a (id INT);\nINSERT INTO missing VALUES (1);")},
+	}
+
+	err := migrate.Migrate(db, testFs, &log)
+
+	var queryErr migrate.ErrorQuery
+
+	if !errors.As(err, &queryErr) {
+		t.Fatalf("Expected ErrorQuery, got %v", err)
+	}
+
+	expected := migrate.ErrorQuery{
+		File:      "2_migrationB_up.sql",
+		Direction: migrate.DirectionUp,
+		Step:      2,
+		Statement: 2,
+		Line:      2,
+		Err:       queryErr.Err,
+	}
+
+	if queryErr != expected {
+		t.Fatalf("Expected %+v, got %+v", expected, queryErr)
+	}
+
+	var sqliteErr sqlite3.Error
+
+	if !errors.As(err, &sqliteErr) || sqliteErr.Code != sqlite3.ErrError {
+		t.Fatalf("Expected wrapped sqlite3.Error, got %v", err)
+	}
+}
@@ -1,6 +1,12 @@
 package migrate
 
-import "strconv"
+import (
+	"context"
+	"database/sql"
+	"net/url"
+	"strconv"
+	"time"
+)
 
 /*
 Representation of a migration, the name should match the name of the
@@ -9,14 +15,50 @@ file without the suffix, for example, a migration with the file name
 
 The step is a numeric representation of the group, migrations are grouped
 based upon when they are executed.
+
+The checksum is the SHA-256 hash (hex encoded) of the migration script at the
+time it was applied, it is used by Verify to detect scripts that have been
+modified since, migrations logged before checksums were recorded have an empty
+checksum.
+
+AppliedAt (UTC), Duration, Executor and Label record when, how quickly and by
+whom the migration was applied (see WithExecutor and WithLabel), they are empty
+for migrations logged before this metadata was recorded.
 */
 type Migration struct {
-	Name string
-	Step int
+	Name      string
+	Step      int
+	Checksum  string
+	AppliedAt time.Time
+	Duration  time.Duration
+	Executor  string
+	Label     string
+}
+
+func (m *Migration) hasMetadata() bool {
+	return !m.AppliedAt.IsZero() || m.Duration != 0 || m.Executor != "" || m.Label != ""
 }
 
+/*
+Line of the file log, `step,name[,checksum]` optionally followed by the
+metadata `,applied at,duration (ms),executor,label`, the executor and label are
+escaped as they are free-form.
+*/
 func (m *Migration) string() string {
-	return strconv.Itoa(m.Step) + "," + m.Name
+	line := strconv.Itoa(m.Step) + "," + m.Name
+
+	if m.Checksum != "" || m.hasMetadata() {
+		line += "," + m.Checksum
+	}
+
+	if m.hasMetadata() {
+		line += "," + formatAppliedAt(m.AppliedAt) +
+			"," + strconv.FormatInt(m.Duration.Milliseconds(), 10) +
+			"," + url.PathEscape(m.Executor) +
+			"," + url.PathEscape(m.Label)
+	}
+
+	return line
 }
 
 /*
@@ -27,10 +69,15 @@ In most cases the log should be stored in the database, the package includes
 implementations for the following DBMS:
 
   - SQLite
-  - MySQL
+  - MySQL/MariaDB
+  - PostgreSQL
+  - SQL Server (see NewLogSQL)
 
+Other DBMS can be supported by implementing a Dialect for LogSQL.
 Alternatively there is also a File implementation (LogFile) or you are free
 to create your own type for whichever DBMS you need.
+
+List should return every migration in the log in the order they were added.
 */
 type MigrationLog interface {
 	Init() error
@@ -38,4 +85,95 @@ type MigrationLog interface {
 	Pop() (Migration, error)
 	Contains(name string) bool
 	LastStep() int
+	List() ([]Migration, error)
+}
+
+/*
+Optional extension of MigrationLog implemented by logs stored in a database.
+
+When the log is stored in the same database that is being migrated, Migrate and
+Rollback will write to the log using the same transaction as the migration
+script, this ensures the log can never get out of sync with the schema.
+
+UsesDB should return true if the log is stored in the given database.
+*/
+type MigrationLogTx interface {
+	MigrationLog
+	UsesDB(db *sql.DB) bool
+	AddTx(ctx context.Context, tx *sql.Tx, m Migration) error
+	PopTx(ctx context.Context, tx *sql.Tx) (Migration, error)
+}
+
+/*
+Optional extension of MigrationLog accepting a context, allowing operations on
+the log to be cancelled or given a deadline.
+
+MigrateContext and RollbackContext will use these methods when available,
+otherwise they fall back to the MigrationLog methods.
+*/
+type MigrationLogContext interface {
+	MigrationLog
+	InitContext(ctx context.Context) error
+	AddContext(ctx context.Context, m Migration) error
+	PopContext(ctx context.Context) (Migration, error)
+	ContainsContext(ctx context.Context, name string) bool
+	LastStepContext(ctx context.Context) int
+	ListContext(ctx context.Context) ([]Migration, error)
+}
+
+// Common interface of sql.DB and sql.Tx used internally by the log drivers
+type queryer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// Returns the transaction aware log if it shares the database with the driver
+func transactionalLog(driver *sql.DB, log MigrationLog) (MigrationLogTx, bool) {
+	txLog, ok := log.(MigrationLogTx)
+
+	if !ok || !txLog.UsesDB(driver) {
+		return nil, false
+	}
+
+	return txLog, true
+}
+
+func logAdd(ctx context.Context, log MigrationLog, m Migration) error {
+	if ctxLog, ok := log.(MigrationLogContext); ok {
+		return ctxLog.AddContext(ctx, m)
+	}
+
+	return log.Add(m)
+}
+
+func logPop(ctx context.Context, log MigrationLog) (Migration, error) {
+	if ctxLog, ok := log.(MigrationLogContext); ok {
+		return ctxLog.PopContext(ctx)
+	}
+
+	return log.Pop()
+}
+
+func logContains(ctx context.Context, log MigrationLog, name string) bool {
+	if ctxLog, ok := log.(MigrationLogContext); ok {
+		return ctxLog.ContainsContext(ctx, name)
+	}
+
+	return log.Contains(name)
+}
+
+func logLastStep(ctx context.Context, log MigrationLog) int {
+	if ctxLog, ok := log.(MigrationLogContext); ok {
+		return ctxLog.LastStepContext(ctx)
+	}
+
+	return log.LastStep()
+}
+
+func logList(ctx context.Context, log MigrationLog) ([]Migration, error) {
+	if ctxLog, ok := log.(MigrationLogContext); ok {
+		return ctxLog.ListContext(ctx)
+	}
+
+	return log.List()
 }
@@ -0,0 +1,101 @@
+package migrate
+
+import "strings"
+
+/*
+Option accepted by the log constructors (e.g. NewLogPostgres), options
+which are not relevant to a log driver are ignored.
+*/
+type LogOption func(*logOptions)
+
+type logOptions struct {
+	schema   string
+	table    string
+	history  bool
+	encoding LogEncoding
+}
+
+func newLogOptions(opts []LogOption) logOptions {
+	options := logOptions{}
+
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	return options
+}
+
+/*
+WithSchema stores the log table in the given schema (the database for MySQL or
+an attached database for SQLite) rather than the default schema of the
+connection, the schema must already exist.
+*/
+func WithSchema(schema string) LogOption {
+	return func(o *logOptions) {
+		o.schema = schema
+	}
+}
+
+/*
+WithTableName names the log table (default `migrations`), the tables used to
+track dirty state, history and locks are named after it (e.g. `{name}_history`).
+This allows several independent sets of migrations to be logged in one database.
+*/
+func WithTableName(name string) LogOption {
+	return func(o *logOptions) {
+		o.table = name
+	}
+}
+
+/*
+WithHistory records every apply and rollback in an append-only history (see
+MigrationLogHistory) in addition to the log, the history is stored in a
+`{table}_history` table (or a `{log file}.history` file).
+*/
+func WithHistory() LogOption {
+	return func(o *logOptions) {
+		o.history = true
+	}
+}
+
+// Quotes the identifier with double quotes (SQLite and PostgreSQL), escaping any embedded quotes
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+/*
+Names of the tables used by LogSQL, schema and name are unquoted
+while the table names are quoted (and schema qualified) ready to be used in
+queries.
+*/
+type logTables struct {
+	schema  string
+	name    string
+	log     string
+	dirty   string
+	history string
+}
+
+func newLogTables(o logOptions, quote func(string) string) logTables {
+	name := o.table
+
+	if name == "" {
+		name = "migrations"
+	}
+
+	qualify := func(table string) string {
+		if o.schema == "" {
+			return quote(table)
+		}
+
+		return quote(o.schema) + "." + quote(table)
+	}
+
+	return logTables{
+		schema:  o.schema,
+		name:    name,
+		log:     qualify(name),
+		dirty:   qualify(name + "_dirty"),
+		history: qualify(name + "_history"),
+	}
+}
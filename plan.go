@@ -0,0 +1,234 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"strings"
+)
+
+// Direction in which migrations are executed
+type Direction string
+
+const (
+	DirectionUp   Direction = "up"
+	DirectionDown Direction = "down"
+)
+
+/*
+A migration that would be executed, File is the script that would run, for
+rollbacks File is empty if the migration has no rollback script (the migration
+would be removed from the log without running a script). Go is true if a Go
+migration function would run instead of a script.
+*/
+type PlannedMigration struct {
+	Name string `json:"name"`
+	File string `json:"file"`
+	Step int    `json:"step"`
+	Go   bool   `json:"go,omitempty"`
+}
+
+/*
+Plan describes the migrations that would be executed by Migrate or Rollback,
+in the order they would be executed.
+*/
+type Plan struct {
+	Direction  Direction          `json:"direction"`
+	Migrations []PlannedMigration `json:"migrations"`
+}
+
+// Returns a human readable representation of the plan
+func (p Plan) String() string {
+	if len(p.Migrations) == 0 && p.Direction == DirectionDown {
+		return "nothing to roll back\n"
+	}
+
+	if len(p.Migrations) == 0 {
+		return "nothing to migrate\n"
+	}
+
+	var b strings.Builder
+
+	for _, m := range p.Migrations {
+		file := m.File
+
+		if m.Go {
+			file = "(go migration)"
+		} else if file == "" {
+			file = "(no rollback script)"
+		}
+
+		fmt.Fprintf(&b, "%s\tstep %d\t%s\t%s\n", p.Direction, m.Step, m.Name, file)
+	}
+
+	return b.String()
+}
+
+/*
+PlanMigrate returns the migrations Migrate would execute without running any
+scripts or modifying the log.
+*/
+func PlanMigrate(directory fs.FS, log MigrationLog) (Plan, error) {
+	return PlanMigrateContext(context.Background(), directory, log)
+}
+
+// PlanMigrateContext is the same as PlanMigrate but accepts a context.
+func PlanMigrateContext(ctx context.Context, directory fs.FS, log MigrationLog) (Plan, error) {
+	migrations, err := pendingMigrations(ctx, directory, log)
+
+	if err != nil {
+		return Plan{}, fmt.Errorf("PlanMigrate: unable to retrieve migration files: %w", err)
+	}
+
+	return planMigrate(ctx, log, migrations), nil
+}
+
+// PlanMigrateTo returns the migrations MigrateTo would execute.
+func PlanMigrateTo(directory fs.FS, log MigrationLog, target string) (Plan, error) {
+	return PlanMigrateToContext(context.Background(), directory, log, target)
+}
+
+// PlanMigrateToContext is the same as PlanMigrateTo but accepts a context.
+func PlanMigrateToContext(ctx context.Context, directory fs.FS, log MigrationLog, target string) (Plan, error) {
+	migrations, err := pendingMigrationsTo(ctx, directory, log, target)
+
+	if err != nil {
+		return Plan{}, fmt.Errorf("PlanMigrateTo: %w", err)
+	}
+
+	return planMigrate(ctx, log, migrations), nil
+}
+
+// PlanMigrateN returns the migrations MigrateN would execute.
+func PlanMigrateN(directory fs.FS, log MigrationLog, n int) (Plan, error) {
+	return PlanMigrateNContext(context.Background(), directory, log, n)
+}
+
+// PlanMigrateNContext is the same as PlanMigrateN but accepts a context.
+func PlanMigrateNContext(ctx context.Context, directory fs.FS, log MigrationLog, n int) (Plan, error) {
+	migrations, err := pendingMigrationsN(ctx, directory, log, n)
+
+	if err != nil {
+		return Plan{}, fmt.Errorf("PlanMigrateN: %w", err)
+	}
+
+	return planMigrate(ctx, log, migrations), nil
+}
+
+// Returns the plan to execute the migrations in a new step
+func planMigrate(ctx context.Context, log MigrationLog, migrations []migrationFile) Plan {
+	plan := Plan{
+		Direction:  DirectionUp,
+		Migrations: []PlannedMigration{},
+	}
+
+	step := logLastStep(ctx, log) + 1
+
+	for _, migration := range migrations {
+		plan.Migrations = append(plan.Migrations, PlannedMigration{
+			Name: migration.name,
+			File: migration.file,
+			Step: step,
+			Go:   migration.file == "",
+		})
+	}
+
+	return plan
+}
+
+/*
+PlanRollback returns the migrations Rollback would reverse, in the order they
+would be rolled back, without running any scripts or modifying the log.
+*/
+func PlanRollback(directory fs.FS, log MigrationLog) (Plan, error) {
+	return PlanRollbackStepsContext(context.Background(), directory, log, 1)
+}
+
+// PlanRollbackContext is the same as PlanRollback but accepts a context.
+func PlanRollbackContext(ctx context.Context, directory fs.FS, log MigrationLog) (Plan, error) {
+	return PlanRollbackStepsContext(ctx, directory, log, 1)
+}
+
+// PlanRollbackSteps returns the migrations RollbackSteps would reverse.
+func PlanRollbackSteps(directory fs.FS, log MigrationLog, n int) (Plan, error) {
+	return PlanRollbackStepsContext(context.Background(), directory, log, n)
+}
+
+// PlanRollbackStepsContext is the same as PlanRollbackSteps but accepts a context.
+func PlanRollbackStepsContext(ctx context.Context, directory fs.FS, log MigrationLog, n int) (Plan, error) {
+	if n < 1 {
+		return Plan{}, fmt.Errorf("PlanRollbackSteps: number of steps must be at least 1, got %d", n)
+	}
+
+	migrations, err := logList(ctx, log)
+
+	if err != nil {
+		return Plan{}, fmt.Errorf("PlanRollback: unable to list migrations: %w", err)
+	}
+
+	// Find the first migration of the n most recent steps
+	start := len(migrations)
+
+	for steps := 0; start > 0; start-- {
+		if start == len(migrations) || migrations[start-1].Step != migrations[start].Step {
+			steps++
+		}
+
+		if steps > n {
+			break
+		}
+	}
+
+	return planRollback(directory, migrations[start:]), nil
+}
+
+// PlanRollbackTo returns the migrations RollbackTo would reverse.
+func PlanRollbackTo(directory fs.FS, log MigrationLog, step int) (Plan, error) {
+	return PlanRollbackToContext(context.Background(), directory, log, step)
+}
+
+// PlanRollbackToContext is the same as PlanRollbackTo but accepts a context.
+func PlanRollbackToContext(ctx context.Context, directory fs.FS, log MigrationLog, step int) (Plan, error) {
+	if step < 0 {
+		return Plan{}, fmt.Errorf("PlanRollbackTo: step must not be negative, got %d", step)
+	}
+
+	migrations, err := logList(ctx, log)
+
+	if err != nil {
+		return Plan{}, fmt.Errorf("PlanRollback: unable to list migrations: %w", err)
+	}
+
+	start := len(migrations)
+
+	for start > 0 && migrations[start-1].Step > step {
+		start--
+	}
+
+	return planRollback(directory, migrations[start:]), nil
+}
+
+// Returns the plan to roll back the migrations, in the reverse order to which they were added to the log
+func planRollback(directory fs.FS, migrations []Migration) Plan {
+	plan := Plan{
+		Direction:  DirectionDown,
+		Migrations: []PlannedMigration{},
+	}
+
+	for i := len(migrations) - 1; i >= 0; i-- {
+		planned := PlannedMigration{
+			Name: migrations[i].Name,
+			Step: migrations[i].Step,
+		}
+
+		if gm, ok := goMigration(directory, migrations[i].Name); ok && gm.Down != nil {
+			planned.Go = true
+		} else if fileName, exists := rollbackFile(directory, migrations[i].Name); exists {
+			planned.File = fileName
+		}
+
+		plan.Migrations = append(plan.Migrations, planned)
+	}
+
+	return plan
+}
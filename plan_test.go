@@ -0,0 +1,160 @@
+package migrate_test
+
+import (
+	"encoding/json"
+	"testing"
+	"testing/fstest"
+
+	"github.com/jameswhoughton/migrate"
+)
+
+// PlanMigrate() returns pending migrations in order without modifying the log
+func TestPlanMigrateReturnsPendingMigrations(t *testing.T) {
+	log := newTestLog()
+	log.Add(migrate.Migration{Name: "1_migrationA", Step: 1})
+
+	testFs := fstest.MapFS{
+		"1_migrationA_up.sql":   {Data: []byte("")},
+		"1_migrationA_down.sql": {Data: []byte("")},
+		"3_migrationC.sql":      {Data: []byte("")},
+		"2_migrationB_up.sql":   {Data: []byte("")},
+		"2_migrationB_down.sql": {Data: []byte("")},
+	}
+
+	plan, err := migrate.PlanMigrate(testFs, &log)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []migrate.PlannedMigration{
+		{Name: "2_migrationB", File: "2_migrationB_up.sql", Step: 2},
+		{Name: "3_migrationC", File: "3_migrationC.sql", Step: 2},
+	}
+
+	if len(plan.Migrations) != len(expected) {
+		t.Fatalf("Expected %d migrations, got %d", len(expected), len(plan.Migrations))
+	}
+
+	for i, m := range expected {
+		if plan.Migrations[i] != m {
+			t.Errorf("Expected %v, got %v", m, plan.Migrations[i])
+		}
+	}
+
+	if len(log.store) != 1 {
+		t.Errorf("Expected log to be unchanged, found %d migrations", len(log.store))
+	}
+}
+
+// PlanRollback() returns the last step in reverse order without modifying the log
+func TestPlanRollbackReturnsLastStepInReverseOrder(t *testing.T) {
+	log := newTestLog()
+	log.Add(migrate.Migration{Name: "1_migrationA", Step: 1})
+	log.Add(migrate.Migration{Name: "2_migrationB", Step: 2})
+	log.Add(migrate.Migration{Name: "3_migrationC", Step: 2})
+
+	testFs := fstest.MapFS{
+		"1_migrationA_down.sql": {Data: []byte("")},
+		"2_migrationB_down.sql": {Data: []byte("")},
+	}
+
+	plan, err := migrate.PlanRollback(testFs, &log)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []migrate.PlannedMigration{
+		{Name: "3_migrationC", File: "", Step: 2},
+		{Name: "2_migrationB", File: "2_migrationB_down.sql", Step: 2},
+	}
+
+	if len(plan.Migrations) != len(expected) {
+		t.Fatalf("Expected %d migrations, got %d", len(expected), len(plan.Migrations))
+	}
+
+	for i, m := range expected {
+		if plan.Migrations[i] != m {
+			t.Errorf("Expected %v, got %v", m, plan.Migrations[i])
+		}
+	}
+
+	if len(log.store) != 3 {
+		t.Errorf("Expected log to be unchanged, found %d migrations", len(log.store))
+	}
+}
+
+// Plan can be serialised to JSON
+func TestPlanCanBeSerialisedToJSON(t *testing.T) {
+	log := newTestLog()
+
+	testFs := fstest.MapFS{
+		"1_migrationA_up.sql": {Data: []byte("")},
+	}
+
+	plan, err := migrate.PlanMigrate(testFs, &log)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := json.Marshal(plan)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{"direction":"up","migrations":[{"name":"1_migrationA","file":"1_migrationA_up.sql","step":1}]}`
+
+	if string(out) != expected {
+		t.Fatalf("Expected %s, got %s", expected, out)
+	}
+}
+
+// PlanRollbackSteps() and PlanRollbackTo() cover multiple steps
+func TestPlanRollbackCoversMultipleSteps(t *testing.T) {
+	log := newTestLog()
+	log.Add(migrate.Migration{Name: "1_migrationA", Step: 1})
+	log.Add(migrate.Migration{Name: "2_migrationB", Step: 2})
+	log.Add(migrate.Migration{Name: "3_migrationC", Step: 2})
+	log.Add(migrate.Migration{Name: "4_migrationD", Step: 3})
+
+	testFs := fstest.MapFS{}
+
+	plan, err := migrate.PlanRollbackSteps(testFs, &log, 2)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(plan.Migrations) != 3 || plan.Migrations[0].Name != "4_migrationD" {
+		t.Fatalf("Expected 3 migrations starting with 4_migrationD, got %v", plan.Migrations)
+	}
+
+	plan, err = migrate.PlanRollbackTo(testFs, &log, 0)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(plan.Migrations) != 4 || plan.Migrations[3].Name != "1_migrationA" {
+		t.Fatalf("Expected 4 migrations ending with 1_migrationA, got %v", plan.Migrations)
+	}
+}
+
+// PlanRollbackSteps() and PlanRollbackTo() reject the same arguments as RollbackSteps() and RollbackTo()
+func TestPlanRollbackRejectsInvalidSteps(t *testing.T) {
+	log := newTestLog()
+	log.Add(migrate.Migration{Name: "1_migrationA", Step: 1})
+
+	testFs := fstest.MapFS{}
+
+	if _, err := migrate.PlanRollbackSteps(testFs, &log, 0); err == nil {
+		t.Fatal("Expected error for 0 steps, got nil")
+	}
+
+	if _, err := migrate.PlanRollbackTo(testFs, &log, -1); err == nil {
+		t.Fatal("Expected error for a negative step, got nil")
+	}
+}
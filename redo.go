@@ -0,0 +1,122 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+)
+
+/*
+Redo rolls back the most recent step (in the same way as Rollback) and then
+applies the rolled back migrations again in a new step, for example to check
+the rollback of a migration while developing it. Only the rolled back
+migrations are applied again, any other pending migrations are left pending.
+The lock (if the log implements Locker) is held for the whole call.
+
+Every rolled back migration must still have a migration script, this is checked
+before anything is rolled back and ErrMigrationNotFound is returned otherwise.
+*/
+func Redo(driver *sql.DB, directory fs.FS, log MigrationLog) error {
+	return RedoContext(context.Background(), driver, directory, log)
+}
+
+// RedoContext is the same as Redo but accepts a context.
+func RedoContext(ctx context.Context, driver *sql.DB, directory fs.FS, log MigrationLog) error {
+	return withLock(ctx, log, func() error {
+		migrations, _, err := redoMigrations(ctx, directory, log)
+
+		if err != nil {
+			return fmt.Errorf("Redo: %w", err)
+		}
+
+		err = rollback(ctx, driver, directory, log)
+
+		if err != nil {
+			return err
+		}
+
+		return runMigrations(ctx, driver, directory, log, migrations)
+	})
+}
+
+/*
+PlanRedo returns the migrations Redo would apply again once the migrations
+returned by PlanRollback have been rolled back.
+*/
+func PlanRedo(directory fs.FS, log MigrationLog) (Plan, error) {
+	return PlanRedoContext(context.Background(), directory, log)
+}
+
+// PlanRedoContext is the same as PlanRedo but accepts a context.
+func PlanRedoContext(ctx context.Context, directory fs.FS, log MigrationLog) (Plan, error) {
+	migrations, step, err := redoMigrations(ctx, directory, log)
+
+	if err != nil {
+		return Plan{}, fmt.Errorf("PlanRedo: %w", err)
+	}
+
+	plan := planMigrate(ctx, log, migrations)
+
+	// The migrations are applied again once the most recent step has been rolled back
+	for i := range plan.Migrations {
+		plan.Migrations[i].Step = step + 1
+	}
+
+	return plan, nil
+}
+
+/*
+Returns the migration files of the most recent step in the log (in the order
+they would be applied) and the step which will be the most recent once it has
+been rolled back.
+*/
+func redoMigrations(ctx context.Context, directory fs.FS, log MigrationLog) ([]migrationFile, int, error) {
+	applied, err := logList(ctx, log)
+
+	if err != nil {
+		return nil, 0, fmt.Errorf("unable to list migrations: %w", err)
+	}
+
+	if len(applied) == 0 {
+		return nil, 0, ErrNothingToRollback
+	}
+
+	last := applied[len(applied)-1].Step
+	start := len(applied)
+	names := map[string]bool{}
+
+	for start > 0 && applied[start-1].Step == last {
+		start--
+		names[applied[start].Name] = true
+	}
+
+	previous := 0
+
+	if start > 0 {
+		previous = applied[start-1].Step
+	}
+
+	files, err := migrationFiles(directory)
+
+	if err != nil {
+		return nil, 0, fmt.Errorf("unable to retrieve migration files: %w", err)
+	}
+
+	var migrations []migrationFile
+
+	for _, file := range files {
+		if names[file.name] {
+			migrations = append(migrations, file)
+			delete(names, file.name)
+		}
+	}
+
+	for _, m := range applied[start:] {
+		if names[m.Name] {
+			return nil, 0, fmt.Errorf("%w: '%s' no longer has a migration script to apply again", ErrMigrationNotFound, m.Name)
+		}
+	}
+
+	return migrations, previous, nil
+}
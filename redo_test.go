@@ -0,0 +1,89 @@
+package migrate_test
+
+import (
+	"database/sql"
+	"errors"
+	"os"
+	"testing"
+	"testing/fstest"
+
+	"github.com/jameswhoughton/migrate"
+)
+
+// Redo() applies only the rolled back migrations again, leaving other pending migrations pending
+func TestRedoAppliesOnlyRolledBackMigrations(t *testing.T) {
+	db, _ := sql.Open("sqlite3", "test.db")
+	defer os.Remove("test.db")
+
+	log := newTestLog()
+
+	testFs := fstest.MapFS{
+		"1_a_up.sql": {Data: []byte("CREATE TABLE a (id INT);")},
+	}
+
+	if err := migrate.Migrate(db, testFs, &log); err != nil {
+		t.Fatal(err)
+	}
+
+	testFs["3_c_up.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE c (id INT);")}
+	testFs["3_c_down.sql"] = &fstest.MapFile{Data: []byte("DROP TABLE c;")}
+
+	if err := migrate.Migrate(db, testFs, &log); err != nil {
+		t.Fatal(err)
+	}
+
+	testFs["2_b_up.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE b (id INT);")}
+
+	plan, err := migrate.PlanRedo(testFs, &log)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(plan.Migrations) != 1 || plan.Migrations[0].Name != "3_c" || plan.Migrations[0].Step != 2 {
+		t.Fatalf("Expected 3_c to be applied again in step 2, got %v", plan.Migrations)
+	}
+
+	err = migrate.Redo(db, testFs, &log)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !tableExists(db, "c") || tableExists(db, "b") {
+		t.Fatal("Expected c to be applied again and b to remain pending")
+	}
+
+	if expected := "1:1_a 2:3_c "; logEntries(log) != expected {
+		t.Fatalf("Expected %s, got %s", expected, logEntries(log))
+	}
+}
+
+// Redo() doesn't roll back anything if a rolled back migration couldn't be applied again
+func TestRedoReturnsErrorIfScriptMissing(t *testing.T) {
+	db, _ := sql.Open("sqlite3", "test.db")
+	defer os.Remove("test.db")
+
+	log := newTestLog()
+
+	testFs := fstest.MapFS{
+		"1_a_up.sql":   {Data: []byte("CREATE TABLE a (id INT);")},
+		"1_a_down.sql": {Data: []byte("DROP TABLE a;")},
+	}
+
+	if err := migrate.Migrate(db, testFs, &log); err != nil {
+		t.Fatal(err)
+	}
+
+	delete(testFs, "1_a_up.sql")
+
+	err := migrate.Redo(db, testFs, &log)
+
+	if !errors.Is(err, migrate.ErrMigrationNotFound) {
+		t.Fatalf("Expected ErrMigrationNotFound, got %v", err)
+	}
+
+	if !tableExists(db, "a") || !log.Contains("1_a") {
+		t.Fatal("Expected 1_a to remain applied")
+	}
+}
@@ -0,0 +1,276 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"time"
+)
+
+/*
+MarkApplied adds the named migration to the log in the given step without
+executing it, this can be used to repair the log after a migration has been
+applied manually (e.g. after it partially failed and the remaining statements
+were run by hand).
+
+The migration must exist in the directory and not already be in the log, the
+log is kept ordered by step so the migration can be added to an earlier step. A
+step of 0 adds the migration in a new step after the most recent one, this is
+resolved once the log is locked.
+*/
+func MarkApplied(directory fs.FS, log MigrationLog, name string, step int) error {
+	return MarkAppliedContext(context.Background(), directory, log, name, step)
+}
+
+// MarkAppliedContext is the same as MarkApplied but accepts a context.
+func MarkAppliedContext(ctx context.Context, directory fs.FS, log MigrationLog, name string, step int) error {
+	if step < 0 {
+		return fmt.Errorf("MarkApplied: step must not be negative, got %d", step)
+	}
+
+	files, err := migrationFiles(directory)
+
+	if err != nil {
+		return fmt.Errorf("MarkApplied: unable to retrieve migration files: %w", err)
+	}
+
+	var migration *migrationFile
+
+	for i := range files {
+		if files[i].name == name || files[i].file == name {
+			migration = &files[i]
+		}
+	}
+
+	if migration == nil {
+		return fmt.Errorf("MarkApplied: %w: '%s'", ErrMigrationNotFound, name)
+	}
+
+	up, err := upScript(directory, *migration)
+
+	if err != nil {
+		return fmt.Errorf("MarkApplied: unable to read migration '%s': %w", migration.key(), err)
+	}
+
+	return withLock(ctx, log, func() error {
+		return rewriteLog(ctx, log, func(migrations []Migration) ([]Migration, error) {
+			for _, m := range migrations {
+				if m.Name == migration.name {
+					return nil, fmt.Errorf("MarkApplied: %w: '%s'", ErrAlreadyApplied, m.Name)
+				}
+			}
+
+			m := Migration{
+				Name:     migration.name,
+				Step:     step,
+				Checksum: up.checksum,
+			}
+
+			if m.Step == 0 {
+				for _, existing := range migrations {
+					m.Step = max(m.Step, existing.Step)
+				}
+
+				m.Step++
+			}
+
+			stampMigration(ctx, &m, time.Now(), 0)
+
+			return append(migrations, m), nil
+		})
+	})
+}
+
+/*
+MarkUnapplied removes the named migration from the log without running its
+rollback, unlike Pop the migration doesn't need to be the most recent entry.
+*/
+func MarkUnapplied(log MigrationLog, name string) error {
+	return MarkUnappliedContext(context.Background(), log, name)
+}
+
+// MarkUnappliedContext is the same as MarkUnapplied but accepts a context.
+func MarkUnappliedContext(ctx context.Context, log MigrationLog, name string) error {
+	return withLock(ctx, log, func() error {
+		return rewriteLog(ctx, log, func(migrations []Migration) ([]Migration, error) {
+			for i, m := range migrations {
+				if m.Name == name {
+					return append(migrations[:i:i], migrations[i+1:]...), nil
+				}
+			}
+
+			return nil, fmt.Errorf("MarkUnapplied: %w: '%s'", ErrNotApplied, name)
+		})
+	})
+}
+
+/*
+ForceStep moves the named migration to the given step, for example to allow it
+to be rolled back separately from the rest of its step.
+*/
+func ForceStep(log MigrationLog, name string, step int) error {
+	return ForceStepContext(context.Background(), log, name, step)
+}
+
+// ForceStepContext is the same as ForceStep but accepts a context.
+func ForceStepContext(ctx context.Context, log MigrationLog, name string, step int) error {
+	if step < 1 {
+		return fmt.Errorf("ForceStep: step must be at least 1, got %d", step)
+	}
+
+	return withLock(ctx, log, func() error {
+		return rewriteLog(ctx, log, func(migrations []Migration) ([]Migration, error) {
+			for i := range migrations {
+				if migrations[i].Name == name {
+					migrations[i].Step = step
+
+					return migrations, nil
+				}
+			}
+
+			return nil, fmt.Errorf("ForceStep: %w: '%s'", ErrNotApplied, name)
+		})
+	})
+}
+
+/*
+RenumberSteps renumbers the steps in the log so they are sequential starting
+from 1 (e.g. steps 1, 4, 9 become 1, 2, 3), migrations in the same step remain
+grouped together.
+*/
+func RenumberSteps(log MigrationLog) error {
+	return RenumberStepsContext(context.Background(), log)
+}
+
+// RenumberStepsContext is the same as RenumberSteps but accepts a context.
+func RenumberStepsContext(ctx context.Context, log MigrationLog) error {
+	return withLock(ctx, log, func() error {
+		return rewriteLog(ctx, log, func(migrations []Migration) ([]Migration, error) {
+			step, previous := 0, 0
+
+			for i := range migrations {
+				if i == 0 || migrations[i].Step != previous {
+					step++
+				}
+
+				previous = migrations[i].Step
+				migrations[i].Step = step
+			}
+
+			return migrations, nil
+		})
+	})
+}
+
+/*
+Applies fn to the migrations in the log and writes the result back, keeping the
+log ordered by step. Only the entries after the first difference are popped and
+re-added so the log is modified using only the MigrationLog interface.
+
+If the log can start a transaction on its database (e.g. LogSQL) the log is
+rewritten within it, otherwise the original entries are restored on error.
+*/
+func rewriteLog(ctx context.Context, log MigrationLog, fn func([]Migration) ([]Migration, error)) error {
+	current, err := logList(ctx, log)
+
+	if err != nil {
+		return fmt.Errorf("unable to list migrations: %w", err)
+	}
+
+	updated, err := fn(append([]Migration{}, current...))
+
+	if err != nil {
+		return err
+	}
+
+	sort.SliceStable(updated, func(i, j int) bool {
+		return updated[i].Step < updated[j].Step
+	})
+
+	unchanged := 0
+
+	for unchanged < len(current) && unchanged < len(updated) && current[unchanged] == updated[unchanged] {
+		unchanged++
+	}
+
+	if txLog, ok := log.(txStarter); ok {
+		return rewriteLogTx(ctx, txLog, len(current)-unchanged, updated[unchanged:])
+	}
+
+	var popped []Migration
+
+	for i := len(current); i > unchanged; i-- {
+		m, err := logPop(ctx, log)
+
+		if err != nil {
+			return errors.Join(fmt.Errorf("unable to pop migration from log: %w", err), restoreLog(ctx, log, 0, popped))
+		}
+
+		popped = append(popped, m)
+	}
+
+	for i, m := range updated[unchanged:] {
+		if err := logAdd(ctx, log, m); err != nil {
+			return errors.Join(fmt.Errorf("unable to add migration '%s' to log: %w", m.Name, err), restoreLog(ctx, log, i, popped))
+		}
+	}
+
+	return nil
+}
+
+// Logs which can start a transaction on the database they are stored in
+type txStarter interface {
+	MigrationLogTx
+	beginTx(ctx context.Context) (*sql.Tx, error)
+}
+
+// Pops n entries and adds the migrations to the log in a single transaction
+func rewriteLogTx(ctx context.Context, log txStarter, n int, migrations []Migration) error {
+	tx, err := log.beginTx(ctx)
+
+	if err != nil {
+		return fmt.Errorf("unable to start transaction: %w", err)
+	}
+
+	for range n {
+		if _, err := log.PopTx(ctx, tx); err != nil {
+			tx.Rollback()
+
+			return fmt.Errorf("unable to pop migration from log: %w", err)
+		}
+	}
+
+	for _, m := range migrations {
+		if err := log.AddTx(ctx, tx, m); err != nil {
+			tx.Rollback()
+
+			return fmt.Errorf("unable to add migration '%s' to log: %w", m.Name, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("unable to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// Removes the added entries and adds back the popped entries (most recent first)
+func restoreLog(ctx context.Context, log MigrationLog, added int, popped []Migration) error {
+	for range added {
+		if _, err := logPop(ctx, log); err != nil {
+			return fmt.Errorf("unable to restore log: %w", err)
+		}
+	}
+
+	for i := len(popped) - 1; i >= 0; i-- {
+		if err := logAdd(ctx, log, popped[i]); err != nil {
+			return fmt.Errorf("unable to restore log: %w", err)
+		}
+	}
+
+	return nil
+}
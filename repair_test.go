@@ -0,0 +1,216 @@
+package migrate_test
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"testing/fstest"
+
+	"github.com/jameswhoughton/migrate"
+)
+
+// Returns the log as "step:name" pairs for comparison
+func logEntries(log testLog) string {
+	entries := ""
+
+	for _, m := range log.store {
+		entries += fmt.Sprintf("%d:%s ", m.Step, m.Name)
+	}
+
+	return entries
+}
+
+// MarkApplied() adds the migration to the log in the given step, keeping the log ordered by step
+func TestMarkAppliedAddsMigrationInStep(t *testing.T) {
+	log := newTestLog()
+	log.Add(migrate.Migration{Name: "1_migrationA", Step: 1})
+	log.Add(migrate.Migration{Name: "3_migrationC", Step: 2})
+
+	testFs := fstest.MapFS{
+		"1_migrationA_up.sql": {Data: []byte("")},
+		"2_migrationB_up.sql": {Data: []byte("CREATE TABLE users (id INT)")},
+		"3_migrationC_up.sql": {Data: []byte("")},
+	}
+
+	err := migrate.MarkApplied(testFs, &log, "2_migrationB", 1)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := "1:1_migrationA 1:2_migrationB 2:3_migrationC "; logEntries(log) != expected {
+		t.Fatalf("Expected %s, got %s", expected, logEntries(log))
+	}
+
+	if log.store[1].Checksum == "" {
+		t.Fatal("Expected checksum to be recorded")
+	}
+
+	err = migrate.MarkApplied(testFs, &log, "2_migrationB", 1)
+
+	if !errors.Is(err, migrate.ErrAlreadyApplied) {
+		t.Fatalf("Expected ErrAlreadyApplied, got %v", err)
+	}
+
+	err = migrate.MarkApplied(testFs, &log, "4_migrationD", 1)
+
+	if !errors.Is(err, migrate.ErrMigrationNotFound) {
+		t.Fatalf("Expected ErrMigrationNotFound, got %v", err)
+	}
+}
+
+// MarkApplied() adds the migration in a new step when the step is 0
+func TestMarkAppliedAddsMigrationInNewStep(t *testing.T) {
+	log := newTestLog()
+	log.Add(migrate.Migration{Name: "1_migrationA", Step: 1})
+	log.Add(migrate.Migration{Name: "2_migrationB", Step: 3})
+
+	testFs := fstest.MapFS{
+		"1_migrationA_up.sql": {Data: []byte("")},
+		"2_migrationB_up.sql": {Data: []byte("")},
+		"3_migrationC_up.sql": {Data: []byte("")},
+	}
+
+	err := migrate.MarkApplied(testFs, &log, "3_migrationC", 0)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := "1:1_migrationA 3:2_migrationB 4:3_migrationC "; logEntries(log) != expected {
+		t.Fatalf("Expected %s, got %s", expected, logEntries(log))
+	}
+}
+
+// MarkUnapplied() removes the named migration from anywhere in the log
+func TestMarkUnappliedRemovesMigration(t *testing.T) {
+	log := newTestLog()
+	log.Add(migrate.Migration{Name: "1_migrationA", Step: 1})
+	log.Add(migrate.Migration{Name: "2_migrationB", Step: 1})
+	log.Add(migrate.Migration{Name: "3_migrationC", Step: 2})
+
+	err := migrate.MarkUnapplied(&log, "2_migrationB")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := "1:1_migrationA 2:3_migrationC "; logEntries(log) != expected {
+		t.Fatalf("Expected %s, got %s", expected, logEntries(log))
+	}
+
+	err = migrate.MarkUnapplied(&log, "2_migrationB")
+
+	if !errors.Is(err, migrate.ErrNotApplied) {
+		t.Fatalf("Expected ErrNotApplied, got %v", err)
+	}
+}
+
+// ForceStep() moves the migration to the given step
+func TestForceStepMovesMigration(t *testing.T) {
+	log := newTestLog()
+	log.Add(migrate.Migration{Name: "1_migrationA", Step: 1})
+	log.Add(migrate.Migration{Name: "2_migrationB", Step: 1})
+	log.Add(migrate.Migration{Name: "3_migrationC", Step: 2})
+
+	err := migrate.ForceStep(&log, "1_migrationA", 3)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := "1:2_migrationB 2:3_migrationC 3:1_migrationA "; logEntries(log) != expected {
+		t.Fatalf("Expected %s, got %s", expected, logEntries(log))
+	}
+}
+
+// RenumberSteps() makes the steps sequential
+func TestRenumberStepsMakesStepsSequential(t *testing.T) {
+	log := newTestLog()
+	log.Add(migrate.Migration{Name: "1_migrationA", Step: 2})
+	log.Add(migrate.Migration{Name: "2_migrationB", Step: 2})
+	log.Add(migrate.Migration{Name: "3_migrationC", Step: 5})
+	log.Add(migrate.Migration{Name: "4_migrationD", Step: 9})
+
+	err := migrate.RenumberSteps(&log)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := "1:1_migrationA 1:2_migrationB 2:3_migrationC 3:4_migrationD "; logEntries(log) != expected {
+		t.Fatalf("Expected %s, got %s", expected, logEntries(log))
+	}
+}
+
+// A log which fails to add migrations in the given step
+type failStepLog struct {
+	testLog
+	failStep int
+}
+
+func (ml *failStepLog) Add(m migrate.Migration) error {
+	if m.Step == ml.failStep {
+		return errors.New("unable to add migration")
+	}
+
+	return ml.testLog.Add(m)
+}
+
+// ForceStep() restores the log if it can't be rewritten
+func TestForceStepRestoresLogOnError(t *testing.T) {
+	log := failStepLog{testLog: newTestLog(), failStep: 3}
+	log.Add(migrate.Migration{Name: "1_migrationA", Step: 1})
+	log.Add(migrate.Migration{Name: "2_migrationB", Step: 1})
+	log.Add(migrate.Migration{Name: "3_migrationC", Step: 2})
+
+	err := migrate.ForceStep(&log, "1_migrationA", 3)
+
+	if err == nil {
+		t.Fatal("Expected error, got nil")
+	}
+
+	if expected := "1:1_migrationA 1:2_migrationB 2:3_migrationC "; logEntries(log.testLog) != expected {
+		t.Fatalf("Expected %s, got %s", expected, logEntries(log.testLog))
+	}
+}
+
+// ForceStep() rewrites a SQL log in a transaction, leaving it untouched on error
+func TestForceStepRollsBackSQLLogOnError(t *testing.T) {
+	db, _ := sql.Open("sqlite3", "test.db")
+	defer os.Remove("test.db")
+
+	log, err := migrate.NewLogSQLite(db)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log.Add(migrate.Migration{Name: "1_migrationA", Step: 1})
+	log.Add(migrate.Migration{Name: "2_migrationB", Step: 1})
+	log.Add(migrate.Migration{Name: "3_migrationC", Step: 2})
+
+	_, err = db.Exec("CREATE TRIGGER fail BEFORE INSERT ON migrations WHEN NEW.step = 3 BEGIN SELECT RAISE(ABORT, 'unable to add migration'); END;")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = migrate.ForceStep(&log, "1_migrationA", 3)
+
+	if err == nil {
+		t.Fatal("Expected error, got nil")
+	}
+
+	migrations, err := log.List()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(migrations) != 3 || migrations[0].Name != "1_migrationA" || migrations[0].Step != 1 {
+		t.Fatalf("Expected the log to be unchanged, got %+v", migrations)
+	}
+}
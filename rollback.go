@@ -1,11 +1,13 @@
 package migrate
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
 	"io/fs"
 	"os"
+	"time"
 )
 
 /*
@@ -25,43 +27,331 @@ The name of the rollback file should match the following format:
 If a migration is missing a rollback file (e.g. a data change that is irreversible)
 no action is taken and the next rollback in the group is processed.
 
-If a rollback fails to run, an `ErrorQuery` error is returned.
+Each rollback script is executed in its own transaction (unless the script
+contains the `-- migrate:no-transaction` directive), if the log implements
+MigrationLogTx and is stored in the same database, the log entry is removed in
+the same transaction. If the script fails the migration remains in the log.
+
+If the log implements Locker the lock is held for the duration of the call.
+
+If a rollback fails to run, an `ErrorQuery` error is returned, if there are no
+migrations to roll back ErrNothingToRollback is returned.
 */
 func Rollback(driver *sql.DB, directory fs.FS, log MigrationLog) error {
-	step := log.LastStep()
+	return RollbackContext(context.Background(), driver, directory, log)
+}
+
+/*
+RollbackContext is the same as Rollback but accepts a context, the context is used
+for all queries and (if the log implements MigrationLogContext) all log operations.
+*/
+func RollbackContext(ctx context.Context, driver *sql.DB, directory fs.FS, log MigrationLog) error {
+	return withLock(ctx, log, func() error {
+		return rollback(ctx, driver, directory, log)
+	})
+}
+
+// Rolls back the most recent step, the caller is responsible for locking
+func rollback(ctx context.Context, driver *sql.DB, directory fs.FS, log MigrationLog) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if err := checkClean(ctx, log); err != nil {
+		return fmt.Errorf("Rollback: %w", err)
+	}
+
+	step := logLastStep(ctx, log)
 
 	if step == 0 {
-		return errors.New("no migrations to roll back")
+		return ErrNothingToRollback
 	}
 
-	for log.LastStep() == step {
-		migration, err := log.Pop()
+	for logLastStep(ctx, log) == step {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		// Marked before any transaction is started as the dirty state may be
+		// stored in the same database
+		last, err := markRollbackStarted(ctx, log)
 
 		if err != nil {
-			return fmt.Errorf("Rollback: unable to pop migration from log: %v", err)
+			return fmt.Errorf("Rollback: unable to mark rollback as started: %w", err)
 		}
 
-		fileName := migration.Name + "_down.sql"
+		start := time.Now()
+		rolledBack, err := rollbackLast(ctx, driver, directory, log)
 
-		if _, err := fs.Stat(directory, fileName); err != nil && errors.Is(err, os.ErrNotExist) {
-			continue
+		// The database is unchanged if the transaction was rolled back
+		if err == nil || rolledBack {
+			if clearErr := logClearDirty(ctx, log); clearErr != nil {
+				return errors.Join(err, fmt.Errorf("Rollback: unable to clear dirty state: %w", clearErr))
+			}
 		}
 
-		query, err := fs.ReadFile(directory, fileName)
+		if last.Name != "" {
+			if historyErr := logHistory(ctx, log, last, DirectionDown, start, err); historyErr != nil {
+				return errors.Join(err, fmt.Errorf("Rollback: unable to record history: %w", historyErr))
+			}
+		}
 
 		if err != nil {
-			return fmt.Errorf("Rollback: unable to read file: %v", err)
+			return err
 		}
+	}
+
+	return nil
+}
+
+/*
+Marks the most recent migration in the log as dirty (if the log tracks dirty
+state) and returns it, the migration is only read if the log tracks dirty state
+or history.
+*/
+func markRollbackStarted(ctx context.Context, log MigrationLog) (Migration, error) {
+	_, dirtyLog := log.(MigrationLogDirty)
+	_, historyLog := log.(MigrationLogHistory)
+
+	if !dirtyLog && !historyLog {
+		return Migration{}, nil
+	}
+
+	migrations, err := logList(ctx, log)
+
+	if err != nil || len(migrations) == 0 {
+		return Migration{}, err
+	}
+
+	last := migrations[len(migrations)-1]
+
+	return last, logSetDirty(ctx, log, last.Name, DirectionDown, last.Step)
+}
+
+/*
+Rolls back the most recent migration in the log, returns true if the script
+failed within a transaction (and was therefore rolled back).
+*/
+func rollbackLast(ctx context.Context, driver *sql.DB, directory fs.FS, log MigrationLog) (bool, error) {
+	if txLog, sharesDB := transactionalLog(driver, log); sharesDB {
+		return rollbackTx(ctx, driver, directory, txLog)
+	}
+
+	migrations, err := logList(ctx, log)
+
+	if err != nil {
+		return true, fmt.Errorf("Rollback: unable to list migrations: %w", err)
+	}
+
+	if len(migrations) == 0 {
+		return true, ErrNothingToRollback
+	}
+
+	migration := migrations[len(migrations)-1]
 
-		_, err = driver.Exec(string(query))
+	down, exists, err := downScript(directory, migration.Name)
+
+	if err != nil {
+		return true, fmt.Errorf("Rollback: unable to read file: %w", err)
+	}
+
+	// The migration is only removed from the log once the script has succeeded
+	if exists {
+		if !down.transaction {
+			err = down.run(ctx, driver)
+		} else {
+			err = runInTx(ctx, driver, down)
+		}
 
 		if err != nil {
-			return ErrorQuery{
-				queryError: err,
-				fileName:   fileName,
+			return down.transaction, newErrorQuery(down, DirectionDown, migration.Step, err)
+		}
+	}
+
+	_, err = logPop(ctx, log)
+
+	if err != nil {
+		return false, fmt.Errorf("Rollback: unable to pop migration from log: %w", err)
+	}
+
+	return false, nil
+}
+
+/*
+RollbackSteps rolls back the `n` most recent steps, each step is rolled back
+in the same way as Rollback. If there are fewer than `n` steps in the log all
+of them are rolled back.
+*/
+func RollbackSteps(driver *sql.DB, directory fs.FS, log MigrationLog, n int) error {
+	return RollbackStepsContext(context.Background(), driver, directory, log, n)
+}
+
+// RollbackStepsContext is the same as RollbackSteps but accepts a context.
+func RollbackStepsContext(ctx context.Context, driver *sql.DB, directory fs.FS, log MigrationLog, n int) error {
+	if n < 1 {
+		return fmt.Errorf("RollbackSteps: number of steps must be at least 1, got %d", n)
+	}
+
+	return withLock(ctx, log, func() error {
+		if logLastStep(ctx, log) == 0 {
+			return ErrNothingToRollback
+		}
+
+		for i := 0; i < n && logLastStep(ctx, log) > 0; i++ {
+			err := rollback(ctx, driver, directory, log)
+
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+/*
+RollbackTo rolls back every step greater than `step`, leaving the migrations
+applied in `step` (and earlier) in place. A step of 0 rolls back everything
+(see Reset).
+*/
+func RollbackTo(driver *sql.DB, directory fs.FS, log MigrationLog, step int) error {
+	return RollbackToContext(context.Background(), driver, directory, log, step)
+}
+
+// RollbackToContext is the same as RollbackTo but accepts a context.
+func RollbackToContext(ctx context.Context, driver *sql.DB, directory fs.FS, log MigrationLog, step int) error {
+	if step < 0 {
+		return fmt.Errorf("RollbackTo: step must not be negative, got %d", step)
+	}
+
+	return withLock(ctx, log, func() error {
+		for logLastStep(ctx, log) > step {
+			err := rollback(ctx, driver, directory, log)
+
+			if err != nil {
+				return err
 			}
 		}
+
+		return nil
+	})
+}
+
+// Reset rolls back every migration in the log.
+func Reset(driver *sql.DB, directory fs.FS, log MigrationLog) error {
+	return ResetContext(context.Background(), driver, directory, log)
+}
+
+// ResetContext is the same as Reset but accepts a context.
+func ResetContext(ctx context.Context, driver *sql.DB, directory fs.FS, log MigrationLog) error {
+	return RollbackToContext(ctx, driver, directory, log, 0)
+}
+
+// Runs the script in a new transaction, rolling back on error
+func runInTx(ctx context.Context, driver *sql.DB, s script) error {
+	tx, err := driver.BeginTx(ctx, nil)
+
+	if err != nil {
+		return err
 	}
 
-	return nil
+	err = runTx(ctx, tx, s)
+
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+/*
+Rolls back the most recent migration, removing it from the log within the same
+transaction, returns true if the script failed within the transaction.
+*/
+func rollbackTx(ctx context.Context, driver *sql.DB, directory fs.FS, log MigrationLogTx) (bool, error) {
+	tx, err := driver.BeginTx(ctx, nil)
+
+	if err != nil {
+		return true, fmt.Errorf("Rollback: unable to start transaction: %w", err)
+	}
+
+	migration, err := log.PopTx(ctx, tx)
+
+	if err != nil {
+		tx.Rollback()
+
+		return true, fmt.Errorf("Rollback: unable to pop migration from log: %w", err)
+	}
+
+	down, exists, err := downScript(directory, migration.Name)
+
+	if err != nil {
+		tx.Rollback()
+
+		return true, fmt.Errorf("Rollback: unable to read file: %w", err)
+	}
+
+	if !exists {
+		return false, tx.Commit()
+	}
+
+	// The log entry can't be removed in the same transaction, restore it and
+	// only remove once the script has run
+	if !down.transaction {
+		tx.Rollback()
+
+		err = down.run(ctx, driver)
+
+		if err != nil {
+			return false, newErrorQuery(down, DirectionDown, migration.Step, err)
+		}
+
+		_, err = logPop(ctx, log)
+
+		if err != nil {
+			return false, fmt.Errorf("Rollback: unable to pop migration from log: %w", err)
+		}
+
+		return false, nil
+	}
+
+	err = runTx(ctx, tx, down)
+
+	if err != nil {
+		return true, newErrorQuery(down, DirectionDown, migration.Step, err)
+	}
+
+	err = tx.Commit()
+
+	if err != nil {
+		return true, fmt.Errorf("Rollback: unable to commit rollback of '%s': %w", migration.Name, err)
+	}
+
+	return false, nil
+}
+
+/*
+Returns the name of the rollback script for the migration and whether it exists,
+if there is no `_down.sql` script the migration file is used if it has a down section.
+*/
+func rollbackFile(directory fs.FS, name string) (string, bool) {
+	fileName := name + "_down.sql"
+
+	if _, err := fs.Stat(directory, fileName); err == nil || !errors.Is(err, os.ErrNotExist) {
+		return fileName, true
+	}
+
+	for _, migrationFile := range []string{name + ".sql", name + "_up.sql"} {
+		query, err := fs.ReadFile(directory, migrationFile)
+
+		if err != nil || !hasSections(query) {
+			continue
+		}
+
+		if _, exists := scriptSection(query, DownDirective); exists {
+			return migrationFile, true
+		}
+	}
+
+	return fileName, false
 }
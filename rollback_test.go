@@ -1,7 +1,9 @@
 package migrate_test
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"os"
 	"testing"
 	"testing/fstest"
@@ -154,3 +156,213 @@ func TestRollbackContinuesIfARollbackFileDoesNotExist(t *testing.T) {
 		t.Errorf("Log file should contain 0 migration, found %d migrations\n", len(migrations))
 	}
 }
+
+// Rollback() should leave the migration in the log if the rollback script fails
+func TestRollbackFailureKeepsMigrationInLog(t *testing.T) {
+	db, _ := sql.Open("sqlite3", "test.db")
+	defer os.Remove("test.db")
+
+	log, err := migrate.NewLogSQLite(db)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testFs := fstest.MapFS{
+		"1_migration_up.sql":   {Data: []byte("CREATE TABLE users (ID INT PRIMARY KEY, name VARCHAR(100));")},
+		"1_migration_down.sql": {Data: []byte("DROP TABLE users; I am not a valid query;")},
+	}
+
+	err = migrate.Migrate(db, testFs, &log)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = migrate.Rollback(db, testFs, &log)
+
+	if err == nil {
+		t.Fatal("Expected error, got nil")
+	}
+
+	if !log.Contains("1_migration") {
+		t.Error("Expected migration to remain in the log")
+	}
+
+	var count int
+
+	db.QueryRow("SELECT COUNT(*) FROM sqlite_schema WHERE type='table' AND name='users';").Scan(&count)
+
+	if count != 1 {
+		t.Error("Expected users table to still exist")
+	}
+}
+
+// A log which can't be added to, any entry popped can't be restored
+type addOnceLog struct {
+	testLog
+	added bool
+}
+
+func (ml *addOnceLog) Add(m migrate.Migration) error {
+	if ml.added {
+		return errors.New("log is read only")
+	}
+
+	ml.added = true
+
+	return ml.testLog.Add(m)
+}
+
+// Rollback() should only remove the migration from a log in another database once the script has succeeded
+func TestRollbackFailureDoesNotPopMigrationFromSeparateLog(t *testing.T) {
+	db, _ := sql.Open("sqlite3", "test.db")
+	defer os.Remove("test.db")
+
+	log := addOnceLog{testLog: newTestLog()}
+
+	testFs := fstest.MapFS{
+		"1_migration_up.sql":   {Data: []byte("CREATE TABLE users (ID INT PRIMARY KEY);")},
+		"1_migration_down.sql": {Data: []byte("I am not a valid query;")},
+	}
+
+	err := migrate.Migrate(db, testFs, &log)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = migrate.Rollback(db, testFs, &log)
+
+	var queryErr migrate.ErrorQuery
+
+	if !errors.As(err, &queryErr) {
+		t.Fatalf("Expected ErrorQuery, got %v", err)
+	}
+
+	if !log.Contains("1_migration") {
+		t.Error("Expected migration to remain in the log")
+	}
+}
+
+// RollbackContext() should not roll back any migrations if the context is cancelled
+func TestRollbackContextStopsWhenContextCancelled(t *testing.T) {
+	db, _ := sql.Open("sqlite3", "test.db")
+	defer os.Remove("test.db")
+
+	log, err := migrate.NewLogSQLite(db)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testFs := fstest.MapFS{
+		"1_migration_up.sql":   {Data: []byte("")},
+		"1_migration_down.sql": {Data: []byte("")},
+	}
+
+	err = migrate.Migrate(db, testFs, &log)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err = migrate.RollbackContext(ctx, db, testFs, &log)
+
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+
+	if !log.Contains("1_migration") {
+		t.Error("Expected migration to remain in the log")
+	}
+}
+
+// Applies three steps of migrations, one migration per step
+func migrateThreeSteps(t *testing.T, db *sql.DB, log migrate.MigrationLog) fstest.MapFS {
+	t.Helper()
+
+	testFs := fstest.MapFS{}
+
+	for _, name := range []string{"1_migrationA", "2_migrationB", "3_migrationC"} {
+		testFs[name+"_up.sql"] = &fstest.MapFile{Data: []byte("")}
+		testFs[name+"_down.sql"] = &fstest.MapFile{Data: []byte("")}
+
+		err := migrate.Migrate(db, testFs, log)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return testFs
+}
+
+// RollbackSteps() rolls back the given number of steps
+func TestRollbackStepsRollsBackNSteps(t *testing.T) {
+	db, _ := sql.Open("sqlite3", "test.db")
+	defer os.Remove("test.db")
+
+	log := newTestLog()
+	testFs := migrateThreeSteps(t, db, &log)
+
+	err := migrate.RollbackSteps(db, testFs, &log, 2)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(log.store) != 1 || log.store[0].Name != "1_migrationA" {
+		t.Fatalf("Expected only 1_migrationA to remain, found %v", log.store)
+	}
+
+	// Rolling back more steps than exist rolls back everything
+	err = migrate.RollbackSteps(db, testFs, &log, 5)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(log.store) != 0 {
+		t.Fatalf("Expected log to be empty, found %v", log.store)
+	}
+
+	// Nothing left to roll back
+	err = migrate.RollbackSteps(db, testFs, &log, 1)
+
+	if !errors.Is(err, migrate.ErrNothingToRollback) {
+		t.Fatalf("Expected ErrNothingToRollback, got %v", err)
+	}
+}
+
+// RollbackTo() rolls back every step after the given step
+func TestRollbackToRollsBackToStep(t *testing.T) {
+	db, _ := sql.Open("sqlite3", "test.db")
+	defer os.Remove("test.db")
+
+	log := newTestLog()
+	testFs := migrateThreeSteps(t, db, &log)
+
+	err := migrate.RollbackTo(db, testFs, &log, 2)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(log.store) != 2 || log.LastStep() != 2 {
+		t.Fatalf("Expected 2 migrations to remain, found %v", log.store)
+	}
+
+	err = migrate.Reset(db, testFs, &log)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(log.store) != 0 {
+		t.Fatalf("Expected log to be empty, found %v", log.store)
+	}
+}
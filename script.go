@@ -0,0 +1,115 @@
+package migrate
+
+import (
+	"context"
+	"io/fs"
+)
+
+// A migration or rollback (SQL script or Go function) ready to be executed
+type script struct {
+	// File name of the script or name of the Go migration
+	source      string
+	run         func(ctx context.Context, db Executor) error
+	transaction bool
+	checksum    string
+}
+
+// Error returned when a single statement within a SQL script fails
+type statementError struct {
+	err error
+	// Position of the statement within the script (1-based)
+	index int
+	// Line on which the statement starts (1-based)
+	line int
+}
+
+func (e statementError) Error() string {
+	return e.err.Error()
+}
+
+func (e statementError) Unwrap() error {
+	return e.err
+}
+
+func sqlScript(fileName string, query []byte) script {
+	return script{
+		source: fileName,
+		run: func(ctx context.Context, db Executor) error {
+			// Statements are executed individually so the failing statement can be reported
+			for i, stmt := range splitStatements(string(query)) {
+				_, err := db.ExecContext(ctx, stmt.query)
+
+				if err != nil {
+					return statementError{err: err, index: i + 1, line: stmt.line}
+				}
+			}
+
+			return nil
+		},
+		transaction: useTransaction(string(query)),
+		checksum:    checksum(query),
+	}
+}
+
+func goScript(name string, fn GoMigrationFunc, noTransaction bool) script {
+	return script{
+		source:      name,
+		run:         fn,
+		transaction: !noTransaction,
+	}
+}
+
+// Loads the script to apply the migration
+func upScript(directory fs.FS, migration migrationFile) (script, error) {
+	if gm, ok := goMigration(directory, migration.name); ok {
+		return goScript(gm.Name, gm.Up, gm.NoTransaction), nil
+	}
+
+	query, err := fs.ReadFile(directory, migration.file)
+
+	if err != nil {
+		return script{}, err
+	}
+
+	if hasSections(query) {
+		query, _ = scriptSection(query, UpDirective)
+	}
+
+	return sqlScript(migration.file, query), nil
+}
+
+// Loads the script to roll back the migration, returns false if the migration has no rollback
+func downScript(directory fs.FS, name string) (script, bool, error) {
+	if gm, ok := goMigration(directory, name); ok && gm.Down != nil {
+		return goScript(gm.Name, gm.Down, gm.NoTransaction), true, nil
+	}
+
+	fileName, exists := rollbackFile(directory, name)
+
+	if !exists {
+		return script{}, false, nil
+	}
+
+	query, err := fs.ReadFile(directory, fileName)
+
+	if err != nil {
+		return script{}, false, err
+	}
+
+	if hasSections(query) {
+		query, _ = scriptSection(query, DownDirective)
+	}
+
+	return sqlScript(fileName, query), true, nil
+}
+
+// Returns true if the migration has a rollback script or Go function
+func hasRollback(directory fs.FS, name string) bool {
+	if gm, ok := goMigration(directory, name); ok && gm.Down != nil {
+		return true
+	}
+
+	_, exists := rollbackFile(directory, name)
+
+	return exists
+}
@@ -0,0 +1,84 @@
+package migrate
+
+import (
+	"strings"
+)
+
+/*
+Directives which split a single migration file into an up and a down section,
+allowing a migration and its rollback to be kept in the same file:
+
+	-- migrate:up
+	CREATE TABLE users (id INT PRIMARY KEY);
+
+	-- migrate:down
+	DROP TABLE users;
+
+Either directive can be followed by `no-transaction` (e.g. `-- migrate:up no-transaction`)
+to run only that section outside of a transaction, the NoTransactionDirective can
+also be included within a section. Any lines before the first directive are ignored.
+*/
+const (
+	UpDirective   = "-- migrate:up"
+	DownDirective = "-- migrate:down"
+)
+
+// Returns the directive and its options if the line is a section directive
+func sectionDirective(line string) (string, []string, bool) {
+	fields := strings.Fields(line)
+
+	if len(fields) < 2 || fields[0] != "--" {
+		return "", nil, false
+	}
+
+	directive := fields[0] + " " + fields[1]
+
+	if directive != UpDirective && directive != DownDirective {
+		return "", nil, false
+	}
+
+	return directive, fields[2:], true
+}
+
+// Returns true if the script contains up/down sections
+func hasSections(query []byte) bool {
+	for _, line := range strings.Split(string(query), "\n") {
+		if directive, _, ok := sectionDirective(line); ok && directive == UpDirective {
+			return true
+		}
+	}
+
+	return false
+}
+
+/*
+Returns the section of the script for the directive and whether the section
+exists. Lines outside of the section are replaced with blank lines so that line
+numbers reported by ErrorQuery match the file.
+*/
+func scriptSection(query []byte, directive string) ([]byte, bool) {
+	lines := strings.Split(string(query), "\n")
+	section := make([]string, len(lines))
+	inSection := false
+	exists := false
+
+	for i, line := range lines {
+		if d, options, ok := sectionDirective(line); ok {
+			inSection = d == directive
+			exists = exists || inSection
+
+			// Keep the option as a directive so it is picked up by useTransaction
+			if inSection && len(options) > 0 && options[0] == "no-transaction" {
+				section[i] = NoTransactionDirective
+			}
+
+			continue
+		}
+
+		if inSection {
+			section[i] = line
+		}
+	}
+
+	return []byte(strings.TrimRight(strings.Join(section, "\n"), "\n")), exists
+}
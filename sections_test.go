@@ -0,0 +1,170 @@
+package migrate_test
+
+import (
+	"database/sql"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/jameswhoughton/migrate"
+)
+
+// Migrate() and Rollback() should run the up and down sections of a single file migration
+func TestSingleFileMigrationRunsSections(t *testing.T) {
+	db, _ := sql.Open("sqlite3", "test.db")
+	defer os.Remove("test.db")
+
+	log := newTestLog()
+
+	testFs := fstest.MapFS{
+		"1_create_users.sql": {Data: []byte("-- migrate:up\nCREATE TABLE users (id INT PRIMARY KEY);\n\n-- migrate:down\nDROP TABLE users;\n")},
+	}
+
+	err := migrate.Migrate(db, testFs, &log)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !tableExists(db, "users") {
+		t.Fatal("Expected users table to exist")
+	}
+
+	status, err := migrate.Status(testFs, &log)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(status) != 1 || status[0].State != migrate.StateApplied {
+		t.Fatalf("Expected migration to be applied with a rollback, got %v", status)
+	}
+
+	err = migrate.Rollback(db, testFs, &log)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tableExists(db, "users") {
+		t.Fatal("Expected users table to be dropped")
+	}
+
+	if len(log.store) != 0 {
+		t.Fatalf("Expected log to be empty, found %v", log.store)
+	}
+}
+
+// A single file migration without a down section has no rollback
+func TestSingleFileMigrationWithoutDownSection(t *testing.T) {
+	db, _ := sql.Open("sqlite3", "test.db")
+	defer os.Remove("test.db")
+
+	log := newTestLog()
+
+	testFs := fstest.MapFS{
+		"1_create_users.sql": {Data: []byte("-- migrate:up\nCREATE TABLE users (id INT PRIMARY KEY);\n")},
+	}
+
+	err := migrate.Migrate(db, testFs, &log)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plan, err := migrate.PlanRollback(testFs, &log)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(plan.Migrations) != 1 || plan.Migrations[0].File != "" {
+		t.Fatalf("Expected migration without a rollback script, got %v", plan.Migrations)
+	}
+}
+
+// Errors in a section should report the line within the file
+func TestSingleFileMigrationReportsFileLine(t *testing.T) {
+	db, _ := sql.Open("sqlite3", "test.db")
+	defer os.Remove("test.db")
+
+	log := newTestLog()
+
+	testFs := fstest.MapFS{
+		"1_create_users.sql": {Data: []byte("-- migrate:up\nCREATE TABLE users (id INT PRIMARY KEY);\n\n-- migrate:down\nDROP TABLE users;\nI am not valid;\n")},
+	}
+
+	err := migrate.Migrate(db, testFs, &log)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = migrate.Rollback(db, testFs, &log)
+
+	if !strings.HasPrefix(err.Error(), "error executing statement 2 (line 6) in 1_create_users.sql") {
+		t.Fatalf("Expected error on line 6, got %v", err)
+	}
+}
+
+// Sections can opt out of transactions independently
+func TestSingleFileMigrationNoTransactionSection(t *testing.T) {
+	db, _ := sql.Open("sqlite3", "test.db")
+	defer os.Remove("test.db")
+
+	log := newTestLog()
+
+	testFs := fstest.MapFS{
+		"1_vacuum.sql": {Data: []byte("-- migrate:up no-transaction\nVACUUM;\n-- migrate:down\nSELECT 1;\n")},
+	}
+
+	// VACUUM fails inside a transaction
+	err := migrate.Migrate(db, testFs, &log)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Changes to the down section should not be reported as drift
+func TestSingleFileMigrationChecksumCoversUpSection(t *testing.T) {
+	db, _ := sql.Open("sqlite3", "test.db")
+	defer os.Remove("test.db")
+
+	log := newTestLog()
+
+	testFs := fstest.MapFS{
+		"1_create_users.sql": {Data: []byte("-- migrate:up\nCREATE TABLE users (id INT PRIMARY KEY);\n-- migrate:down\nDROP TABLE users;\n")},
+	}
+
+	err := migrate.Migrate(db, testFs, &log)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testFs["1_create_users.sql"] = &fstest.MapFile{Data: []byte("-- migrate:up\nCREATE TABLE users (id INT PRIMARY KEY);\n-- migrate:down\nDROP TABLE IF EXISTS users;\n")}
+
+	drift, err := migrate.Verify(testFs, &log)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(drift) != 0 {
+		t.Fatalf("Expected no drift, got %v", drift)
+	}
+
+	testFs["1_create_users.sql"] = &fstest.MapFile{Data: []byte("-- migrate:up\nCREATE TABLE users (id BIGINT PRIMARY KEY);\n-- migrate:down\nDROP TABLE users;\n")}
+
+	drift, err = migrate.Verify(testFs, &log)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(drift) != 1 {
+		t.Fatalf("Expected drift, got %v", drift)
+	}
+}
@@ -0,0 +1,386 @@
+package migrate
+
+import (
+	"strings"
+	"unicode"
+)
+
+// A single statement from a script, line is the line (1-based) on which it starts
+type statement struct {
+	query string
+	line  int
+}
+
+/*
+Splits a script into individual statements, allowing scripts containing multiple
+statements to be executed on drivers that only accept a single statement per query
+(e.g. MySQL without `multiStatements=true`).
+
+Statements are separated by `;` unless the delimiter is changed with a MySQL
+style `DELIMITER` line. The following are taken into account so that delimiters
+within them don't end the statement:
+
+  - quoted strings and identifiers ('...', "..." and `...`), including
+    backslash escapes (MySQL strings and PostgreSQL E'...' strings)
+  - PostgreSQL dollar quoted strings ($$...$$ and $tag$...$tag$)
+  - line (-- and, at the start of a line or statement, MySQL #) and block comments
+  - BEGIN ... END blocks within CREATE statements (triggers, procedures, functions)
+
+Statements containing only comments are discarded.
+
+The dialect isn't known so backslashes are always treated as escapes, this
+differs from PostgreSQL standard strings where a backslash is literal. A string
+ending with a backslash followed by other strings in the script (e.g.
+`VALUES ('C:\'); INSERT ... ('D:\');`) merges the following statements (up to
+the rest of the script), they still run as PostgreSQL accepts several
+statements per query but the position and line reported by ErrorQuery are
+those of the merged statement. E'C:\\' avoids this.
+*/
+func splitStatements(script string) []statement {
+	var statements []statement
+
+	delimiter := ";"
+	current := strings.Builder{}
+	startLine := 0
+	line := 1
+	// Depth of BEGIN/CASE ... END blocks
+	depth := 0
+	// First keyword of the statement
+	firstWord := ""
+	// Whether the statement creates a trigger, procedure, function or event
+	routine := false
+	// Depth of parentheses, BEGIN within them is an identifier (e.g. a column name)
+	parens := 0
+	// Keyword immediately before the current one (only separated by whitespace)
+	previous := ""
+
+	flush := func() {
+		if startLine > 0 {
+			statements = append(statements, statement{
+				query: strings.TrimSpace(current.String()),
+				line:  startLine,
+			})
+		}
+
+		current.Reset()
+		startLine = 0
+		depth = 0
+		firstWord = ""
+		routine = false
+		parens = 0
+		previous = ""
+	}
+
+	for i := 0; i < len(script); {
+		// Delimiter changes are only recognised at the start of a statement
+		if startLine == 0 && isLineStart(script, i) {
+			if newDelimiter, length, ok := parseDelimiter(script[i:]); ok {
+				delimiter = newDelimiter
+				i += length
+				current.Reset()
+
+				continue
+			}
+		}
+
+		c := script[i]
+
+		switch {
+		case c == '\n':
+			current.WriteByte(c)
+			line++
+			i++
+
+		// # is only a comment in MySQL, elsewhere it's an operator (e.g. PostgreSQL's XOR)
+		case strings.HasPrefix(script[i:], "--") || c == '#' && (startLine == 0 || isLineStart(script, i)):
+			end := strings.IndexByte(script[i:], '\n')
+
+			if end == -1 {
+				end = len(script) - i
+			}
+
+			current.WriteString(script[i : i+end])
+			i += end
+
+		case strings.HasPrefix(script[i:], "/*"):
+			end := strings.Index(script[i+2:], "*/")
+
+			if end == -1 {
+				end = len(script) - i
+			} else {
+				end += 4
+			}
+
+			line += strings.Count(script[i:i+end], "\n")
+			current.WriteString(script[i : i+end])
+			i += end
+
+		case strings.HasPrefix(script[i:], delimiter) && (delimiter != ";" || depth == 0):
+			flush()
+			i += len(delimiter)
+
+		case unicode.IsSpace(rune(c)):
+			current.WriteByte(c)
+			i++
+
+		default:
+			if startLine == 0 {
+				startLine = line
+			}
+
+			length := quotedLength(script[i:])
+
+			if length > 0 {
+				previous = ""
+				line += strings.Count(script[i:i+length], "\n")
+				current.WriteString(script[i : i+length])
+				i += length
+
+				continue
+			}
+
+			if !isWordChar(c) {
+				previous = ""
+
+				if c == '(' {
+					parens++
+				} else if c == ')' && parens > 0 {
+					parens--
+				}
+
+				current.WriteByte(c)
+				i++
+
+				continue
+			}
+
+			word := script[i:]
+
+			for j := 0; j < len(word); j++ {
+				if !isWordChar(word[j]) {
+					word = word[:j]
+
+					break
+				}
+			}
+
+			// Only track blocks in word boundaries
+			if i == 0 || !isWordChar(script[i-1]) {
+				keyword := strings.ToUpper(word)
+
+				if firstWord == "" {
+					firstWord = keyword
+				}
+
+				if firstWord == "CREATE" && parens == 0 && isRoutineKeyword(keyword) {
+					routine = true
+				}
+
+				depth += blockDepthChange(keyword, previous, script[i+len(word):], routine && parens == 0, depth)
+				previous = keyword
+			}
+
+			current.WriteString(word)
+			i += len(word)
+		}
+	}
+
+	flush()
+
+	return statements
+}
+
+/*
+Returns the change in block depth caused by the keyword, previous is the keyword
+before it, rest is the script following it and body is true if the keyword is
+in the body of a trigger, procedure, function or event.
+*/
+func blockDepthChange(keyword, previous, rest string, body bool, depth int) int {
+	next := nextWord(rest)
+
+	switch keyword {
+	case "BEGIN":
+		// Elsewhere BEGIN starts a transaction or is an identifier (e.g. `CREATE TABLE t (begin DATE)`)
+		if !body {
+			return 0
+		}
+
+		// An identifier within the body, e.g. `RETURN begin;`
+		if strings.IndexAny(strings.TrimLeftFunc(rest, unicode.IsSpace), ",);") == 0 {
+			return 0
+		}
+
+		if next == "TRANSACTION" || next == "WORK" || next == "DEFERRED" || next == "IMMEDIATE" || next == "EXCLUSIVE" {
+			return 0
+		}
+
+		return 1
+	case "CASE":
+		// END CASE closes the block opened by CASE, END has already been counted
+		if previous == "END" {
+			return 0
+		}
+
+		return 1
+	case "END":
+		// END IF, END LOOP etc. close blocks that weren't counted
+		if next == "IF" || next == "LOOP" || next == "WHILE" || next == "REPEAT" || next == "FOR" {
+			return 0
+		}
+
+		if depth == 0 {
+			return 0
+		}
+
+		return -1
+	}
+
+	return 0
+}
+
+func isRoutineKeyword(keyword string) bool {
+	return keyword == "TRIGGER" || keyword == "PROCEDURE" || keyword == "FUNCTION" || keyword == "EVENT"
+}
+
+// Returns the next word (upper case) after any whitespace
+func nextWord(s string) string {
+	s = strings.TrimLeftFunc(s, unicode.IsSpace)
+
+	for i := 0; i < len(s); i++ {
+		if !isWordChar(s[i]) {
+			return strings.ToUpper(s[:i])
+		}
+	}
+
+	return strings.ToUpper(s)
+}
+
+func isWordChar(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+// Returns true if i is the first non-whitespace character on its line
+func isLineStart(script string, i int) bool {
+	for j := i - 1; j >= 0; j-- {
+		if script[j] == '\n' {
+			return true
+		}
+
+		if script[j] != ' ' && script[j] != '\t' && script[j] != '\r' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Parses a `DELIMITER x` line, returning the delimiter and the length of the line
+func parseDelimiter(s string) (string, int, bool) {
+	indent := len(s)
+	s = strings.TrimLeft(s, " \t\r")
+	indent -= len(s)
+
+	if len(s) < 10 || !strings.EqualFold(s[:9], "DELIMITER") || (s[9] != ' ' && s[9] != '\t') {
+		return "", 0, false
+	}
+
+	end := strings.IndexByte(s, '\n')
+
+	if end == -1 {
+		end = len(s)
+	}
+
+	delimiter := strings.TrimSpace(s[9:end])
+
+	if delimiter == "" {
+		return "", 0, false
+	}
+
+	return delimiter, indent + end, true
+}
+
+/*
+Returns the length of the quoted string at the start of s (0 if s doesn't start
+with a quote). Backslashes escape the next character in strings as MySQL does
+by default, a string which isn't terminated when they are is read again without
+escapes as PostgreSQL strings (other than E'...') don't support them (e.g. 'C:\').
+*/
+func quotedLength(s string) int {
+	switch s[0] {
+	case '\'', '"':
+		if length, ok := quotedStringLength(s, true); ok {
+			return length
+		}
+
+		length, _ := quotedStringLength(s, false)
+
+		return length
+	case '`':
+		length, _ := quotedStringLength(s, false)
+
+		return length
+	case 'E', 'e':
+		// PostgreSQL escape string
+		if len(s) > 1 && s[1] == '\'' {
+			length, _ := quotedStringLength(s[1:], true)
+
+			return length + 1
+		}
+	case '$':
+		end := strings.IndexByte(s[1:], '$')
+
+		if end == -1 {
+			return 0
+		}
+
+		tag := s[:end+2]
+
+		for i := 1; i < len(tag)-1; i++ {
+			if !isWordChar(tag[i]) || tag[i] >= '0' && tag[i] <= '9' && i == 1 {
+				return 0
+			}
+		}
+
+		closing := strings.Index(s[len(tag):], tag)
+
+		if closing == -1 {
+			return len(s)
+		}
+
+		return len(tag) + closing + len(tag)
+	}
+
+	return 0
+}
+
+/*
+Returns the length of the string quoted by the first character of s and false if
+it isn't terminated, quotes within the string are escaped by doubling them or,
+if backslash is true, with a backslash.
+*/
+func quotedStringLength(s string, backslash bool) (int, bool) {
+	quote := s[0]
+
+	for i := 1; i < len(s); i++ {
+		if backslash && s[i] == '\\' {
+			i++
+
+			continue
+		}
+
+		if s[i] != quote {
+			continue
+		}
+
+		// Quotes are escaped by doubling them
+		if i+1 < len(s) && s[i+1] == quote {
+			i++
+
+			continue
+		}
+
+		return i + 1, true
+	}
+
+	return len(s), false
+}
@@ -0,0 +1,175 @@
+package migrate
+
+import (
+	"testing"
+)
+
+// splitStatements() should split a script into its statements, ignoring delimiters in quotes, comments and blocks
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		name     string
+		script   string
+		expected []statement
+	}{
+		{
+			name:   "simple statements",
+			script: "CREATE TABLE a (id INT);\nCREATE TABLE b (id INT);\n",
+			expected: []statement{
+				{query: "CREATE TABLE a (id INT)", line: 1},
+				{query: "CREATE TABLE b (id INT)", line: 2},
+			},
+		},
+		{
+			name:     "no trailing delimiter",
+			script:   "SELECT 1",
+			expected: []statement{{query: "SELECT 1", line: 1}},
+		},
+		{
+			name:   "quoted delimiters",
+			script: "INSERT INTO a VALUES ('a;b', \"c;d\", `e;f`, 'it''s;');\nSELECT 1;",
+			expected: []statement{
+				{query: "INSERT INTO a VALUES ('a;b', \"c;d\", `e;f`, 'it''s;')", line: 1},
+				{query: "SELECT 1", line: 2},
+			},
+		},
+		{
+			name:   "comments",
+			script: "-- first; statement\nSELECT 1; /* multi\nline; */ SELECT 2;\n-- trailing comment;",
+			expected: []statement{
+				{query: "-- first; statement\nSELECT 1", line: 2},
+				{query: "/* multi\nline; */ SELECT 2", line: 3},
+			},
+		},
+		{
+			name:   "dollar quotes",
+			script: "CREATE FUNCTION f() RETURNS INT AS $body$ SELECT 1; $body$ LANGUAGE sql;\nSELECT $$a;b$$;",
+			expected: []statement{
+				{query: "CREATE FUNCTION f() RETURNS INT AS $body$ SELECT 1; $body$ LANGUAGE sql", line: 1},
+				{query: "SELECT $$a;b$$", line: 2},
+			},
+		},
+		{
+			name: "trigger block",
+			script: "CREATE TRIGGER t AFTER INSERT ON a\nBEGIN\n  UPDATE b SET n = CASE WHEN n > 0 THEN n + 1 ELSE 1 END;\n" +
+				"  DELETE FROM c;\nEND;\nSELECT 1;",
+			expected: []statement{
+				{query: "CREATE TRIGGER t AFTER INSERT ON a\nBEGIN\n  UPDATE b SET n = CASE WHEN n > 0 THEN n + 1 ELSE 1 END;\n  DELETE FROM c;\nEND", line: 1},
+				{query: "SELECT 1", line: 6},
+			},
+		},
+		{
+			name: "procedure with control flow",
+			script: "CREATE PROCEDURE p()\nBEGIN\n  IF 1 THEN\n    SELECT 1;\n  END IF;\n  WHILE 0 DO\n    SELECT 2;\n  END WHILE;\nEND;\n" +
+				"SELECT 3;",
+			expected: []statement{
+				{query: "CREATE PROCEDURE p()\nBEGIN\n  IF 1 THEN\n    SELECT 1;\n  END IF;\n  WHILE 0 DO\n    SELECT 2;\n  END WHILE;\nEND", line: 1},
+				{query: "SELECT 3", line: 10},
+			},
+		},
+		{
+			name:   "transaction begin",
+			script: "BEGIN;\nSELECT 1;\nEND;",
+			expected: []statement{
+				{query: "BEGIN", line: 1},
+				{query: "SELECT 1", line: 2},
+				{query: "END", line: 3},
+			},
+		},
+		{
+			name:   "delimiter",
+			script: "DELIMITER //\nCREATE PROCEDURE p()\nBEGIN\n  SELECT 1;\nEND//\nDELIMITER ;\nSELECT 2;",
+			expected: []statement{
+				{query: "CREATE PROCEDURE p()\nBEGIN\n  SELECT 1;\nEND", line: 2},
+				{query: "SELECT 2", line: 7},
+			},
+		},
+		{
+			name:   "backslash escapes",
+			script: "INSERT INTO t VALUES ('it\\'s; here', \"a \\\" ;\");\nSELECT E'b\\';';\nSELECT 1;",
+			expected: []statement{
+				{query: "INSERT INTO t VALUES ('it\\'s; here', \"a \\\" ;\")", line: 1},
+				{query: "SELECT E'b\\';'", line: 2},
+				{query: "SELECT 1", line: 3},
+			},
+		},
+		{
+			name:   "trailing backslash without escapes",
+			script: "INSERT INTO t VALUES ('C:\\');\nSELECT 1;",
+			expected: []statement{
+				{query: "INSERT INTO t VALUES ('C:\\')", line: 1},
+				{query: "SELECT 1", line: 2},
+			},
+		},
+		{
+			// Known limitation, PostgreSQL standard strings are read with backslash escapes
+			name:   "trailing backslashes merge statements",
+			script: "INSERT INTO t VALUES ('C:\\');\nINSERT INTO t VALUES ('D:\\');\nSELECT 1;",
+			expected: []statement{
+				{query: "INSERT INTO t VALUES ('C:\\');\nINSERT INTO t VALUES ('D:\\');\nSELECT 1;", line: 1},
+			},
+		},
+		{
+			name:   "escape strings with trailing backslashes",
+			script: "INSERT INTO t VALUES (E'C:\\\\');\nINSERT INTO t VALUES (E'D:\\\\');\nSELECT 1;",
+			expected: []statement{
+				{query: "INSERT INTO t VALUES (E'C:\\\\')", line: 1},
+				{query: "INSERT INTO t VALUES (E'D:\\\\')", line: 2},
+				{query: "SELECT 1", line: 3},
+			},
+		},
+		{
+			name:   "hash comments",
+			script: "# don't run twice\nINSERT INTO a VALUES (1);\nINSERT INTO a VALUES (2); # isn't; needed\nSELECT data #> '{a}';",
+			expected: []statement{
+				{query: "# don't run twice\nINSERT INTO a VALUES (1)", line: 2},
+				{query: "INSERT INTO a VALUES (2)", line: 3},
+				{query: "# isn't; needed\nSELECT data #> '{a}'", line: 4},
+			},
+		},
+		{
+			name:   "begin as an identifier",
+			script: "CREATE TABLE periods (begin DATE, finish DATE);\nINSERT INTO periods VALUES ('2024-01-01', '2024-02-01');",
+			expected: []statement{
+				{query: "CREATE TABLE periods (begin DATE, finish DATE)", line: 1},
+				{query: "INSERT INTO periods VALUES ('2024-01-01', '2024-02-01')", line: 2},
+			},
+		},
+		{
+			name:   "begin as a parameter",
+			script: "CREATE FUNCTION f(begin INT) RETURNS INT\nBEGIN\n  RETURN begin;\nEND;\nSELECT 1;",
+			expected: []statement{
+				{query: "CREATE FUNCTION f(begin INT) RETURNS INT\nBEGIN\n  RETURN begin;\nEND", line: 1},
+				{query: "SELECT 1", line: 5},
+			},
+		},
+		{
+			name:   "end case",
+			script: "CREATE PROCEDURE p() BEGIN CASE x WHEN 1 THEN SELECT 1; END CASE; SELECT 2; END; SELECT 3;",
+			expected: []statement{
+				{query: "CREATE PROCEDURE p() BEGIN CASE x WHEN 1 THEN SELECT 1; END CASE; SELECT 2; END", line: 1},
+				{query: "SELECT 3", line: 1},
+			},
+		},
+		{
+			name:     "comments only",
+			script:   "-- nothing to see here;\n/* or here; */\n",
+			expected: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitStatements(tt.script)
+
+			if len(got) != len(tt.expected) {
+				t.Fatalf("Expected %d statements, got %d: %q", len(tt.expected), len(got), got)
+			}
+
+			for i, stmt := range tt.expected {
+				if got[i] != stmt {
+					t.Errorf("Expected %q, got %q", stmt, got[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"sort"
+)
+
+// State of a migration as reported by Status
+type State string
+
+const (
+	// Applied and both the migration and rollback scripts exist
+	StateApplied State = "applied"
+	// Not yet applied
+	StatePending State = "pending"
+	// Applied but the migration script no longer exists in the directory
+	StateMissing State = "missing"
+	// Applied but there is no rollback script
+	StateNoRollback State = "no-rollback"
+)
+
+/*
+The state of a single migration, Step is the step in which the migration was
+applied (0 for pending migrations).
+*/
+type MigrationStatus struct {
+	Name  string `json:"name"`
+	State State  `json:"state"`
+	Step  int    `json:"step"`
+}
+
+// Returns true if the migration has been applied (regardless of the state of its scripts)
+func (s MigrationStatus) Applied() bool {
+	return s.State != StatePending
+}
+
+/*
+Status returns every migration found in either the directory or the log along
+with its state, ordered by name (the order in which they would be executed).
+*/
+func Status(directory fs.FS, log MigrationLog) ([]MigrationStatus, error) {
+	return StatusContext(context.Background(), directory, log)
+}
+
+// StatusContext is the same as Status but accepts a context.
+func StatusContext(ctx context.Context, directory fs.FS, log MigrationLog) ([]MigrationStatus, error) {
+	files, err := migrationFiles(directory)
+
+	if err != nil {
+		return nil, fmt.Errorf("Status: unable to retrieve migration files: %w", err)
+	}
+
+	applied, err := logList(ctx, log)
+
+	if err != nil {
+		return nil, fmt.Errorf("Status: unable to list migrations: %w", err)
+	}
+
+	statuses := map[string]MigrationStatus{}
+
+	for _, file := range files {
+		statuses[file.name] = MigrationStatus{
+			Name:  file.name,
+			State: StatePending,
+		}
+	}
+
+	for _, migration := range applied {
+		status := MigrationStatus{
+			Name:  migration.Name,
+			State: StateApplied,
+			Step:  migration.Step,
+		}
+
+		if _, exists := statuses[migration.Name]; !exists {
+			status.State = StateMissing
+		} else if !hasRollback(directory, migration.Name) {
+			status.State = StateNoRollback
+		}
+
+		statuses[migration.Name] = status
+	}
+
+	report := make([]MigrationStatus, 0, len(statuses))
+
+	for _, status := range statuses {
+		report = append(report, status)
+	}
+
+	sort.Slice(report, func(i, j int) bool {
+		return report[i].Name < report[j].Name
+	})
+
+	return report, nil
+}
@@ -0,0 +1,47 @@
+package migrate_test
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/jameswhoughton/migrate"
+)
+
+// Status() reports applied, pending, missing and no-rollback migrations
+func TestStatusReportsStateOfEachMigration(t *testing.T) {
+	log := newTestLog()
+	log.Add(migrate.Migration{Name: "1_migrationA", Step: 1})
+	log.Add(migrate.Migration{Name: "2_migrationB", Step: 1})
+	log.Add(migrate.Migration{Name: "3_migrationC", Step: 2})
+
+	testFs := fstest.MapFS{
+		"1_migrationA_up.sql":   {Data: []byte("")},
+		"1_migrationA_down.sql": {Data: []byte("")},
+		"3_migrationC_up.sql":   {Data: []byte("")},
+		"4_migrationD_up.sql":   {Data: []byte("")},
+		"4_migrationD_down.sql": {Data: []byte("")},
+	}
+
+	report, err := migrate.Status(testFs, &log)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []migrate.MigrationStatus{
+		{Name: "1_migrationA", State: migrate.StateApplied, Step: 1},
+		{Name: "2_migrationB", State: migrate.StateMissing, Step: 1},
+		{Name: "3_migrationC", State: migrate.StateNoRollback, Step: 2},
+		{Name: "4_migrationD", State: migrate.StatePending, Step: 0},
+	}
+
+	if len(report) != len(expected) {
+		t.Fatalf("Expected %d migrations, got %d", len(expected), len(report))
+	}
+
+	for i, status := range expected {
+		if report[i] != status {
+			t.Errorf("Expected %v, got %v", status, report[i])
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+)
+
+/*
+Directive which can be added to a script (on its own line) to prevent it from
+running in a transaction, this is required for statements which cannot be
+executed inside a transaction, for example `CREATE INDEX CONCURRENTLY` in PostgreSQL
+or `VACUUM` in SQLite.
+*/
+const NoTransactionDirective = "-- migrate:no-transaction"
+
+// Returns false if the script contains the no transaction directive
+func useTransaction(query string) bool {
+	for _, line := range strings.Split(query, "\n") {
+		if strings.TrimSpace(line) == NoTransactionDirective {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Runs the script within the transaction, the transaction is rolled back on error
+func runTx(ctx context.Context, tx *sql.Tx, s script) error {
+	err := s.run(ctx, tx)
+
+	if err != nil {
+		tx.Rollback()
+	}
+
+	return err
+}
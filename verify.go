@@ -0,0 +1,116 @@
+package migrate
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+)
+
+// Returns the hex encoded SHA-256 hash of the script
+func checksum(script []byte) string {
+	hash := sha256.Sum256(script)
+
+	return hex.EncodeToString(hash[:])
+}
+
+// Reason an applied migration no longer matches its script
+type DriftReason string
+
+const (
+	// The script has been modified since the migration was applied
+	DriftChanged DriftReason = "changed"
+	// The script no longer exists in the directory
+	DriftMissing DriftReason = "missing"
+)
+
+/*
+An applied migration which no longer matches its script, Expected is the checksum
+recorded in the log and Actual the checksum of the current script (empty if the
+script is missing).
+*/
+type Drift struct {
+	Name     string      `json:"name"`
+	Step     int         `json:"step"`
+	Reason   DriftReason `json:"reason"`
+	Expected string      `json:"expected"`
+	Actual   string      `json:"actual"`
+}
+
+func (d Drift) String() string {
+	return fmt.Sprintf("%s (step %d): %s", d.Name, d.Step, d.Reason)
+}
+
+/*
+Verify compares the checksum of every applied migration with the current
+content of its script, returning the migrations whose script has changed or
+no longer exists, in the order they appear in the log.
+
+Migrations logged without a checksum (applied by earlier versions of this
+package) are only reported if the script is missing.
+*/
+func Verify(directory fs.FS, log MigrationLog) ([]Drift, error) {
+	return VerifyContext(context.Background(), directory, log)
+}
+
+// VerifyContext is the same as Verify but accepts a context.
+func VerifyContext(ctx context.Context, directory fs.FS, log MigrationLog) ([]Drift, error) {
+	files, err := migrationFiles(directory)
+
+	if err != nil {
+		return nil, fmt.Errorf("Verify: unable to retrieve migration files: %w", err)
+	}
+
+	scripts := map[string]string{}
+
+	for _, file := range files {
+		scripts[file.name] = file.file
+	}
+
+	applied, err := logList(ctx, log)
+
+	if err != nil {
+		return nil, fmt.Errorf("Verify: unable to list migrations: %w", err)
+	}
+
+	drift := []Drift{}
+
+	for _, migration := range applied {
+		fileName, exists := scripts[migration.Name]
+
+		if !exists {
+			drift = append(drift, Drift{
+				Name:     migration.Name,
+				Step:     migration.Step,
+				Reason:   DriftMissing,
+				Expected: migration.Checksum,
+			})
+
+			continue
+		}
+
+		// Go migrations don't have a checksum
+		if migration.Checksum == "" || fileName == "" {
+			continue
+		}
+
+		up, err := upScript(directory, migrationFile{name: migration.Name, file: fileName})
+
+		if err != nil {
+			return nil, fmt.Errorf("Verify: unable to read migration '%s': %w", fileName, err)
+		}
+
+		if actual := up.checksum; actual != migration.Checksum {
+			drift = append(drift, Drift{
+				Name:     migration.Name,
+				Step:     migration.Step,
+				Reason:   DriftChanged,
+				Expected: migration.Checksum,
+				Actual:   actual,
+			})
+		}
+	}
+
+	return drift, nil
+}
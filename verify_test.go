@@ -0,0 +1,80 @@
+package migrate_test
+
+import (
+	"database/sql"
+	"os"
+	"testing"
+	"testing/fstest"
+
+	"github.com/jameswhoughton/migrate"
+)
+
+// Migrate() records the checksum of each script in the log
+func TestMigrateRecordsChecksum(t *testing.T) {
+	db, _ := sql.Open("sqlite3", "test.db")
+	defer os.Remove("test.db")
+
+	log := newTestLog()
+
+	testFs := fstest.MapFS{
+		"1_migrationA_up.sql": {Data: []byte("")},
+	}
+
+	err := migrate.Migrate(db, testFs, &log)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// SHA-256 of an empty script
+	expected := "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+	if log.store[0].Checksum != expected {
+		t.Fatalf("Expected checksum %s, got %s", expected, log.store[0].Checksum)
+	}
+}
+
+// Verify() reports changed and missing scripts
+func TestVerifyReportsChangedAndMissingScripts(t *testing.T) {
+	db, _ := sql.Open("sqlite3", "test.db")
+	defer os.Remove("test.db")
+
+	log := newTestLog()
+
+	testFs := fstest.MapFS{
+		"1_migrationA_up.sql": {Data: []byte("")},
+		"2_migrationB_up.sql": {Data: []byte("")},
+		"3_migrationC_up.sql": {Data: []byte("")},
+	}
+
+	err := migrate.Migrate(db, testFs, &log)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Migrations logged before checksums were recorded are only checked for existence
+	log.Add(migrate.Migration{Name: "4_migrationD", Step: 2})
+	testFs["4_migrationD_up.sql"] = &fstest.MapFile{Data: []byte("SELECT 1;")}
+
+	testFs["2_migrationB_up.sql"] = &fstest.MapFile{Data: []byte("SELECT 1;")}
+	delete(testFs, "3_migrationC_up.sql")
+
+	drift, err := migrate.Verify(testFs, &log)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(drift) != 2 {
+		t.Fatalf("Expected 2 drifted migrations, got %v", drift)
+	}
+
+	if drift[0].Name != "2_migrationB" || drift[0].Reason != migrate.DriftChanged {
+		t.Errorf("Expected 2_migrationB to have changed, got %v", drift[0])
+	}
+
+	if drift[1].Name != "3_migrationC" || drift[1].Reason != migrate.DriftMissing {
+		t.Errorf("Expected 3_migrationC to be missing, got %v", drift[1])
+	}
+}